@@ -27,15 +27,28 @@
 //	}))
 //
 // Note:  async.Loop terminates the loop when the inner function
-// returns an error or the context is canceled.
+// returns an error or the context is canceled.  To keep the loop
+// running through transient failures, use async.LoopWithRestart:
+//
+//	errc := async.LoopWithRestart(ctx, runner, async.DefaultRestartPolicy)
+//	... later
+//	if err := <-errc; err != nil {
+//	    ... the policy gave up ...
+//	}
 //
 // To wait for all go-routines to terminate, use Tasks.Wait.  See
-// examples for using Tasks
+// examples for using Tasks.  During shutdown, prefer WaitContext
+// which gives up on the deadline and reports the task failures:
+//
+//	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+//	defer cancel()
+//	err := tasks.WaitContext(ctx)
 package async
 
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"sync"
 	"time"
@@ -59,9 +72,24 @@ type Closer interface {
 }
 
 // TaskGroup is an asyncronous task runner that wraps a WaitGroup
+//
+// Panics in tasks are recovered and reported as a PanicError (see
+// Run and Loop). Set Repanic to crash the process instead.
 type TaskGroup struct {
 	Name string
+
+	// Repanic re-raises recovered panics after recording them, for
+	// callers that prefer failing fast.
+	Repanic bool
+
 	sync.WaitGroup
+
+	// tasks tracks the tasks started by the group, see Snapshot.
+	tasks taskRegistry
+
+	// waitDone is closed once the tasks finished, see waiter.
+	waitLock sync.Mutex
+	waitDone chan struct{}
 }
 
 // NewTaskGroup creates new instance of TaskGroup
@@ -72,40 +100,175 @@ func NewTaskGroup(name string) *TaskGroup {
 // Run executes a single asynchronous task.
 //
 // It creates a new trace for the task and passes through deadlines.
+// Panics are recovered, recorded on the span and logged with their
+// stack.
 func (t *TaskGroup) Run(ctx context.Context, r Runner) {
+	task := t.tasks.start(t.taskName(r), "run")
 	t.WaitGroup.Add(1)
 	go func() {
 		defer t.WaitGroup.Done()
 		ctx2 := trace.StartSpan(ctx, t.Name)
 		defer trace.End(ctx2)
-		if err := r.Run(ctx2); err != nil && !errors.Is(err, context.Canceled) {
+		t.tasks.iteration(task)
+		err := t.runTask(ctx2, r)
+		if err != nil && !errors.Is(err, context.Canceled) {
 			log.Error(ctx2, t.Name, events.NewErrorInfo(err))
+		} else {
+			err = nil
 		}
+		t.tasks.finish(task, err)
 	}()
 }
 
-// Loop repeatedly executes the provided task until it returns false
+// Loop repeatedly executes the provided task until it returns an error
 // or the context is canceled.
+//
+// A panic in the task is recovered and handled like an error, as a
+// PanicError. Use LoopWithRestart to keep the loop running through
+// errors.
 func (t *TaskGroup) Loop(ctx context.Context, r Runner) {
-	run := func(ctx context.Context) bool {
+	t.loop(ctx, r, nil)
+}
+
+// LoopWithRestart is like Loop, except that errors do not terminate the
+// loop: the task is restarted after a backoff until the restart policy
+// gives up.
+//
+// The returned channel receives the error that terminated the loop (if
+// any) and is closed when the loop exits.
+func (t *TaskGroup) LoopWithRestart(ctx context.Context, r Runner, p RestartPolicy) <-chan error {
+	return t.loop(ctx, r, newRestarter(p))
+}
+
+// loop runs the task of Loop and LoopWithRestart. A nil restarter exits
+// on the first error.
+func (t *TaskGroup) loop(ctx context.Context, r Runner, rs *restarter) <-chan error {
+	task := t.tasks.start(t.taskName(r), "loop")
+	run := func(ctx context.Context, attempt int) error {
 		ctx2 := trace.StartSpan(ctx, t.Name)
 		defer trace.End(ctx2)
-		if err := r.Run(ctx2); err != nil && !errors.Is(err, context.Canceled) {
+		if attempt > 0 {
+			trace.AddInfo(ctx2, log.F{"async.restart.attempt": attempt})
+		}
+		t.tasks.iteration(task)
+		if err := t.runTask(ctx2, r); err != nil && !errors.Is(err, context.Canceled) {
 			log.Error(ctx2, t.Name, events.NewErrorInfo(err))
-			return true
+			t.tasks.failed(task, err)
+			return err
 		}
-		return false
+		return nil
 	}
 
+	errc := make(chan error, 1)
 	t.WaitGroup.Add(1)
 	go func() {
 		defer t.WaitGroup.Done()
+		defer close(errc)
+
+		var final error
+		defer func() {
+			t.tasks.finish(task, final)
+			if final != nil {
+				errc <- final
+			}
+		}()
+
+		attempt := 0
 		for ctx.Err() == nil {
-			if ok := run(ctx); ok {
-				break
+			err := run(ctx, attempt)
+			if err == nil {
+				continue
+			}
+
+			if rs == nil {
+				final = err
+				return
+			}
+
+			delay, ok := rs.next(time.Now())
+			if !ok {
+				final = fmt.Errorf("%s: gave up after %d restarts: %w", t.Name, rs.attempt, err)
+				log.Error(ctx, "async.loop gave up", log.F{"name": t.Name}, events.NewErrorInfo(final))
+				return
 			}
+			attempt = rs.attempt
+
+			log.Warn(ctx, "async.loop restarting", log.F{
+				"name":                  t.Name,
+				"async.restart.attempt": attempt,
+				"async.restart.backoff": delay.String(),
+			}, events.NewErrorInfo(err))
+			t.tasks.backoff(task)
+			Sleep(ctx, delay)
 		}
 	}()
+
+	return errc
+}
+
+// WaitContext waits for all tasks to finish, like Wait, but returns
+// early when ctx is done.
+//
+// It returns the failures of the tasks that finished since the previous
+// call to WaitContext, at most the latest 100, joined with errors.Join.
+// Each failure is a TaskError tagged with the name of the task and wraps
+// the original error, so status codes added with orerr are preserved.
+// If ctx is done before all tasks finish, ctx.Err() is joined to the
+// result. A goroutine then keeps waiting for the tasks in the
+// background, shared by all the calls to WaitContext of the group.
+func (t *TaskGroup) WaitContext(ctx context.Context) error {
+	var waitErr error
+	select {
+	case <-t.waiter():
+	case <-ctx.Done():
+		waitErr = fmt.Errorf("%s: tasks still running: %w", t.Name, ctx.Err())
+	}
+
+	errs := t.tasks.drainErrors()
+	if waitErr != nil {
+		errs = append(errs, waitErr)
+	}
+	return errors.Join(errs...)
+}
+
+// waiter returns a channel closed once all tasks finished. The channel
+// and the goroutine waiting for the tasks are shared until the tasks
+// finish, so that calls to WaitContext returning early do not pile up
+// goroutines.
+func (t *TaskGroup) waiter() <-chan struct{} {
+	t.waitLock.Lock()
+	defer t.waitLock.Unlock()
+	if t.waitDone == nil {
+		done := make(chan struct{})
+		t.waitDone = done
+		go func() {
+			t.WaitGroup.Wait()
+			t.waitLock.Lock()
+			t.waitDone = nil
+			t.waitLock.Unlock()
+			close(done)
+		}()
+	}
+	return t.waitDone
+}
+
+// TaskError is a task failure reported by TaskGroup.WaitContext.
+type TaskError struct {
+	// Task is the name of the task that failed.
+	Task string
+
+	// Err is the error returned by the task.
+	Err error
+}
+
+// Error implements the err interface.
+func (e *TaskError) Error() string {
+	return e.Task + ": " + e.Err.Error()
+}
+
+// Unwrap returns the error returned by the task.
+func (e *TaskError) Unwrap() error {
+	return e.Err
 }
 
 // Default is the default runner
@@ -156,6 +319,13 @@ func Loop(ctx context.Context, r Runner) {
 	Default.Loop(ctx, r)
 }
 
+// LoopWithRestart repeatedly executes the provided task, restarting it
+// on errors according to the restart policy. See
+// TaskGroup.LoopWithRestart.
+func LoopWithRestart(ctx context.Context, r Runner, p RestartPolicy) <-chan error {
+	return Default.LoopWithRestart(ctx, r, p)
+}
+
 // Func is a helper that implements the Runner interface
 type Func func(ctx context.Context) error
 
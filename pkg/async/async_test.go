@@ -4,11 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"runtime"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/grevych/gobox/pkg/async"
+	"github.com/grevych/gobox/pkg/orerr"
+	"github.com/grevych/gobox/pkg/statuscodes"
 	"gotest.tools/v3/assert"
 	is "gotest.tools/v3/assert/cmp"
 )
@@ -181,6 +184,65 @@ func TestTaskGroup_LoopWithContextCanceled(t *testing.T) {
 	assert.Assert(t, true)
 }
 
+func TestTaskGroup_LoopWithRestart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	counter := atomic.Int32{}
+	tg := async.TaskGroup{Name: "test"}
+	errc := tg.LoopWithRestart(ctx, async.Func(func(ctx context.Context) error {
+		if counter.Add(1) <= 3 {
+			return errors.New("some error")
+		}
+		cancel()
+		return nil
+	}), async.RestartPolicy{
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		Multiplier:     2,
+		Jitter:         0.5,
+	})
+
+	tg.Wait()
+	assert.NilError(t, <-errc)
+	assert.Equal(t, int32(4), counter.Load())
+}
+
+func TestTaskGroup_LoopRestartPolicyGivesUp(t *testing.T) {
+	ctx := context.Background()
+
+	counter := atomic.Int32{}
+	tg := async.TaskGroup{Name: "test"}
+	errc := tg.LoopWithRestart(ctx, async.Func(func(ctx context.Context) error {
+		counter.Add(1)
+		return errors.New("some error")
+	}), async.RestartPolicy{
+		InitialBackoff: time.Millisecond,
+		MaxRestarts:    2,
+		Window:         time.Minute,
+	})
+
+	tg.Wait()
+	err := <-errc
+	assert.ErrorContains(t, err, "gave up after 2 restarts: some error")
+	assert.Equal(t, int32(3), counter.Load())
+}
+
+func TestTaskGroup_LoopRestartPolicyCanceledDuringBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	tg := async.TaskGroup{Name: "test"}
+	errc := tg.LoopWithRestart(ctx, async.Func(func(ctx context.Context) error {
+		return errors.New("some error")
+	}), async.RestartPolicy{InitialBackoff: time.Hour})
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	tg.Wait()
+	assert.NilError(t, <-errc)
+}
+
 func ExampleTaskGroup_run() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -247,3 +309,56 @@ func ExampleTaskGroup_loop() {
 	// count 2
 	// count 3
 }
+
+func TestTaskGroup_WaitContext(t *testing.T) {
+	tasks := async.TaskGroup{Name: "test"}
+	ctx := context.Background()
+
+	tasks.Run(ctx, async.Func(func(context.Context) error { return nil }))
+	tasks.Run(ctx, async.Named("limited", async.Func(func(context.Context) error {
+		return orerr.NewErrorStatus(errors.New("slow down"), statuscodes.RateLimited)
+	})))
+	tasks.Run(ctx, async.Named("broken", async.Func(func(context.Context) error {
+		return errors.New("boom")
+	})))
+
+	err := tasks.WaitContext(ctx)
+	assert.ErrorContains(t, err, "limited: ")
+	assert.ErrorContains(t, err, "broken: boom")
+	assert.Equal(t, orerr.ExtractErrorStatusCode(err), statuscodes.RateLimited)
+
+	var taskErr *async.TaskError
+	assert.Assert(t, errors.As(err, &taskErr))
+
+	// failures are only reported once
+	assert.NilError(t, tasks.WaitContext(ctx))
+}
+
+func TestTaskGroup_WaitContextDeadline(t *testing.T) {
+	tasks := async.TaskGroup{Name: "test"}
+	stop := make(chan struct{})
+	defer tasks.Wait()
+	defer close(stop)
+
+	tasks.Run(context.Background(), async.Func(func(context.Context) error {
+		<-stop
+		return nil
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := tasks.WaitContext(ctx)
+	assert.Assert(t, errors.Is(err, context.DeadlineExceeded))
+	assert.ErrorContains(t, err, "test: tasks still running")
+
+	// the calls returning early share the goroutine waiting for the tasks
+	goroutines := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		assert.Assert(t, errors.Is(tasks.WaitContext(ctx), context.DeadlineExceeded))
+	}
+	assert.Assert(t, runtime.NumGoroutine() <= goroutines, "%d goroutines, %d before", runtime.NumGoroutine(), goroutines)
+
+	stop <- struct{}{}
+	assert.NilError(t, tasks.WaitContext(context.Background()))
+}
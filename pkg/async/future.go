@@ -0,0 +1,223 @@
+// Description: Provides typed futures for running functions asynchronously
+
+package async
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/grevych/gobox/pkg/trace"
+)
+
+// ErrNoFutures is returned when awaiting the first result of an empty
+// list of futures.
+var ErrNoFutures = errors.New("async: no futures to await")
+
+// Future is the eventual result of a function started with Go, or of
+// work run elsewhere, see NewFuture.
+type Future[T any] struct {
+	name   string
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	value T
+	err   error
+}
+
+// Go runs fn asynchronously and returns a Future for its result.
+//
+// Like TaskGroup.Run, fn runs under its own span, named after the
+// future, and passes through deadlines. Canceling ctx (or calling
+// Cancel) cancels the context provided to fn. A panic in fn is
+// recovered and returned as a PanicError.
+//
+//	user := async.Go(ctx, "get-user", func(ctx context.Context) (*User, error) {
+//	    return users.Get(ctx, id)
+//	})
+//	orders := async.Go(ctx, "list-orders", func(ctx context.Context) ([]Order, error) {
+//	    return orders.List(ctx, id)
+//	})
+//
+//	u, err := async.Await(ctx, user)
+func Go[T any](ctx context.Context, name string, fn func(ctx context.Context) (T, error)) *Future[T] {
+	ctx, cancel := context.WithCancel(ctx)
+	f := &Future[T]{
+		name:   name,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(f.done)
+		defer cancel()
+
+		ctx = trace.StartSpan(ctx, name)
+		defer trace.End(ctx)
+
+		f.value, f.err = f.run(ctx, fn)
+		//nolint:errcheck // Why: only recording the error on the span
+		_ = trace.Error(ctx, f.err)
+	}()
+	return f
+}
+
+// NewFuture creates a pending future for code that runs the work
+// itself, like a worker pool. The future completes on the first call to
+// complete, later calls are ignored. cancel, which may be nil, is called
+// by Future.Cancel.
+func NewFuture[T any](name string, cancel context.CancelFunc) (f *Future[T], complete func(value T, err error)) {
+	f = &Future[T]{
+		name:   name,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	var once sync.Once
+	return f, func(value T, err error) {
+		once.Do(func() {
+			f.value, f.err = value, err
+			close(f.done)
+		})
+	}
+}
+
+// run calls fn, converting panics into errors.
+func (f *Future[T]) run(ctx context.Context, fn func(ctx context.Context) (T, error)) (value T, err error) {
+	defer RecoverPanic(ctx, "future", &err)
+	return fn(ctx)
+}
+
+// Name returns the name of the future.
+func (f *Future[T]) Name() string {
+	return f.name
+}
+
+// Done returns a channel that is closed when the future completes.
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Cancel cancels the context of the function run by the future. It
+// does not wait for the function to return.
+func (f *Future[T]) Cancel() {
+	if f.cancel != nil {
+		f.cancel()
+	}
+}
+
+// result returns the result of a completed future, with the error
+// tagged with the name of the future.
+func (f *Future[T]) result() (T, error) {
+	if f.err != nil {
+		return f.value, &TaskError{Task: f.name, Err: f.err}
+	}
+	return f.value, nil
+}
+
+// Await waits for the future to complete and returns its result. It
+// returns early with ctx.Err() if ctx is done first, leaving the future
+// running.
+//
+// Errors returned by the function are wrapped in a TaskError tagged
+// with the name of the future.
+func Await[T any](ctx context.Context, f *Future[T]) (T, error) {
+	select {
+	case <-f.done:
+		return f.result()
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// AwaitAll waits for all the futures to complete and returns their
+// values, in the order of the futures. The failures of the futures are
+// joined with errors.Join.
+//
+// It returns early with ctx.Err() if ctx is done first.
+func AwaitAll[T any](ctx context.Context, futures ...*Future[T]) ([]T, error) {
+	values := make([]T, len(futures))
+	errs := []error{}
+	for i, f := range futures {
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		var err error
+		values[i], err = f.result()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return values, errors.Join(errs...)
+}
+
+// AwaitAny waits for the first future to complete and returns its
+// result, whether it failed or not. The other futures are canceled.
+func AwaitAny[T any](ctx context.Context, futures ...*Future[T]) (T, error) {
+	f, err := awaitFirst(ctx, futures, func(*Future[T]) bool { return true })
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return f.result()
+}
+
+// AwaitFirstSuccess waits for the first future to succeed and returns
+// its value. The other futures are canceled. If every future fails,
+// their failures are joined with errors.Join.
+func AwaitFirstSuccess[T any](ctx context.Context, futures ...*Future[T]) (T, error) {
+	f, err := awaitFirst(ctx, futures, func(f *Future[T]) bool { return f.err == nil })
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return f.result()
+}
+
+// awaitFirst returns the first future to complete that is accepted. The
+// other futures are canceled once a future is accepted. When no future
+// is accepted, the failures of all the futures are returned.
+func awaitFirst[T any](ctx context.Context, futures []*Future[T], accept func(*Future[T]) bool) (*Future[T], error) {
+	if len(futures) == 0 {
+		return nil, ErrNoFutures
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	completed := make(chan *Future[T], len(futures))
+	for _, f := range futures {
+		go func(f *Future[T]) {
+			select {
+			case <-f.done:
+				completed <- f
+			case <-stop:
+			}
+		}(f)
+	}
+
+	errs := []error{}
+	for range futures {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case f := <-completed:
+			if accept(f) {
+				for _, other := range futures {
+					if other != f {
+						other.Cancel()
+					}
+				}
+				return f, nil
+			}
+			if _, err := f.result(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return nil, errors.Join(errs...)
+}
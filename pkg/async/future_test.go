@@ -0,0 +1,123 @@
+package async_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grevych/gobox/pkg/async"
+	"gotest.tools/v3/assert"
+)
+
+// after returns a future function that returns v (or err) after d, or
+// the context error when canceled first.
+func after[T any](d time.Duration, v T, err error) func(context.Context) (T, error) {
+	return func(ctx context.Context) (T, error) {
+		select {
+		case <-time.After(d):
+			return v, err
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		}
+	}
+}
+
+func TestAwait(t *testing.T) {
+	ctx := context.Background()
+
+	v, err := async.Await(ctx, async.Go(ctx, "ok", after(0, 42, nil)))
+	assert.NilError(t, err)
+	assert.Equal(t, v, 42)
+
+	_, err = async.Await(ctx, async.Go(ctx, "failing", after(0, 0, errors.New("boom"))))
+	assert.Error(t, err, "failing: boom")
+
+	var taskErr *async.TaskError
+	assert.Assert(t, errors.As(err, &taskErr))
+	assert.Equal(t, taskErr.Task, "failing")
+}
+
+func TestAwait_Panic(t *testing.T) {
+	ctx := context.Background()
+	f := async.Go(ctx, "panicking", func(context.Context) (int, error) {
+		panic("oops")
+	})
+
+	_, err := async.Await(ctx, f)
+	var panicErr *async.PanicError
+	assert.Assert(t, errors.As(err, &panicErr))
+	assert.ErrorContains(t, err, "panicking: panic: oops")
+}
+
+func TestAwait_ContextDone(t *testing.T) {
+	f := async.Go(context.Background(), "slow", after(time.Hour, 1, nil))
+	defer f.Cancel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := async.Await(ctx, f)
+	assert.Assert(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestAwait_Cancel(t *testing.T) {
+	ctx := context.Background()
+	f := async.Go(ctx, "slow", after(time.Hour, 1, nil))
+	f.Cancel()
+
+	_, err := async.Await(ctx, f)
+	assert.Assert(t, errors.Is(err, context.Canceled))
+}
+
+func TestAwaitAll(t *testing.T) {
+	ctx := context.Background()
+
+	values, err := async.AwaitAll(ctx,
+		async.Go(ctx, "first", after(10*time.Millisecond, 1, nil)),
+		async.Go(ctx, "second", after(0, 2, nil)),
+	)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, values, []int{1, 2})
+
+	_, err = async.AwaitAll(ctx,
+		async.Go(ctx, "first", after(0, 1, errors.New("boom"))),
+		async.Go(ctx, "second", after(0, 2, nil)),
+		async.Go(ctx, "third", after(0, 3, errors.New("bang"))),
+	)
+	assert.Error(t, err, "first: boom\nthird: bang")
+}
+
+func TestAwaitAny(t *testing.T) {
+	ctx := context.Background()
+	slow := async.Go(ctx, "slow", after(time.Hour, 1, nil))
+
+	_, err := async.AwaitAny(ctx, slow, async.Go(ctx, "fast", after(0, 2, errors.New("boom"))))
+	assert.Error(t, err, "fast: boom")
+
+	// the other futures are canceled
+	_, err = async.Await(ctx, slow)
+	assert.Assert(t, errors.Is(err, context.Canceled))
+
+	_, err = async.AwaitAny[int](ctx)
+	assert.Assert(t, errors.Is(err, async.ErrNoFutures))
+}
+
+func TestAwaitFirstSuccess(t *testing.T) {
+	ctx := context.Background()
+
+	v, err := async.AwaitFirstSuccess(ctx,
+		async.Go(ctx, "failing", after(0, 1, errors.New("boom"))),
+		async.Go(ctx, "ok", after(10*time.Millisecond, 2, nil)),
+		async.Go(ctx, "slow", after(time.Hour, 3, nil)),
+	)
+	assert.NilError(t, err)
+	assert.Equal(t, v, 2)
+
+	_, err = async.AwaitFirstSuccess(ctx,
+		async.Go(ctx, "first", after(0, 1, errors.New("boom"))),
+		async.Go(ctx, "second", after(10*time.Millisecond, 2, errors.New("bang"))),
+	)
+	assert.Error(t, err, "first: boom\nsecond: bang")
+}
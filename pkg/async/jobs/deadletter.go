@@ -0,0 +1,63 @@
+// Description: Provides the dead-letter stores of the job runner
+
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DeadLetter is a job that failed for good.
+type DeadLetter struct {
+	// Job is the job, with the number of its last attempt.
+	Job Job
+
+	// Err is the error of the last attempt.
+	Err error
+
+	// At is when the job was dead-lettered.
+	At time.Time
+}
+
+// DeadLetterStore stores the jobs that failed for good, for inspection
+// or to enqueue them again once fixed.
+type DeadLetterStore interface {
+	Put(ctx context.Context, letter DeadLetter) error
+}
+
+// MemoryDeadLetterStore is a DeadLetterStore keeping the dead letters in
+// memory. It is the default store of runners.
+type MemoryDeadLetterStore struct {
+	lock    sync.Mutex
+	letters []DeadLetter
+}
+
+// NewMemoryDeadLetterStore creates an empty MemoryDeadLetterStore.
+func NewMemoryDeadLetterStore() *MemoryDeadLetterStore {
+	return &MemoryDeadLetterStore{}
+}
+
+// Put stores a dead letter.
+func (s *MemoryDeadLetterStore) Put(_ context.Context, letter DeadLetter) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.letters = append(s.letters, letter)
+	return nil
+}
+
+// List returns the dead letters, oldest first.
+func (s *MemoryDeadLetterStore) List() []DeadLetter {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]DeadLetter(nil), s.letters...)
+}
+
+// Drain removes and returns the dead letters, oldest first.
+func (s *MemoryDeadLetterStore) Drain() []DeadLetter {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	letters := s.letters
+	s.letters = nil
+	return letters
+}
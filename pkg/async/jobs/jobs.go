@@ -0,0 +1,404 @@
+// Description: Provides an in-process job runner with retries and dead letters
+
+// Package jobs runs jobs in the background with handlers registered by
+// job type.
+//
+//	runner := jobs.NewRunner("billing", jobs.Workers(4))
+//	runner.Handle("invoice.charge", jobs.HandlerFunc(func(ctx context.Context, job jobs.Job) error {
+//	    err := billing.Charge(ctx, job.Payload.(*Invoice))
+//	    if isTransient(err) {
+//	        return orerr.Retryable(err)
+//	    }
+//	    return err
+//	}))
+//	async.Run(ctx, runner)
+//
+//	id, err := runner.Enqueue(jobs.Job{Type: "invoice.charge", Payload: invoice})
+//
+// A dequeued job stays invisible to the other workers for the visibility
+// timeout. The deadline of its handler is a tenth of the visibility
+// timeout earlier, to leave time to record the outcome of the job. A job
+// whose handler does not return before the visibility timeout expires is
+// dequeued again.
+//
+// Jobs failing with an error marked with orerr.Retryable are retried
+// after a backoff computed from the retry policy. Jobs failing otherwise,
+// or after the maximum number of attempts of the policy, are put in the
+// dead-letter store.
+//
+// Every attempt runs as its own trace.StartCall, with the wait and service
+// times of the job.
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/grevych/gobox/pkg/async"
+	"github.com/grevych/gobox/pkg/events"
+	"github.com/grevych/gobox/pkg/log"
+	"github.com/grevych/gobox/pkg/orerr"
+	"github.com/grevych/gobox/pkg/queue"
+	"github.com/grevych/gobox/pkg/retry"
+	"github.com/grevych/gobox/pkg/trace"
+)
+
+// DefaultVisibilityTimeout is the default visibility timeout of jobs.
+const DefaultVisibilityTimeout = 30 * time.Second
+
+// visibilityMargin is the fraction of the visibility timeout between the
+// deadline of a handler and the end of the visibility timeout.
+const visibilityMargin = 10
+
+// DefaultRetryPolicy is the default retry policy of jobs: at most five
+// attempts with an exponential backoff starting at one second and capped
+// at five minutes.
+//
+//nolint:gochecknoglobals // Why: shared defaults
+var DefaultRetryPolicy = retry.Policy{
+	Strategy:     retry.Exponential,
+	MaxAttempts:  5,
+	InitialDelay: time.Second,
+	MaxDelay:     5 * time.Minute,
+	Multiplier:   2,
+	Jitter:       0.2,
+}
+
+// ErrNoHandler is the error of the jobs whose type has no handler.
+var ErrNoHandler = errors.New("no handler for job type")
+
+// Job is a unit of work run by the handler of its type.
+type Job struct {
+	// ID identifies the job. Enqueue generates one when it is empty.
+	ID string
+
+	// Type selects the handler of the job.
+	Type string
+
+	// Payload is the input of the handler.
+	Payload interface{}
+
+	// RunAt is when the job runs first. Zero runs it as soon as possible.
+	RunAt time.Time
+
+	// Attempt is the number of the current attempt, starting at 1. It is
+	// set by the runner.
+	Attempt int
+}
+
+// MarshalLog logs the job without its payload.
+func (j *Job) MarshalLog(addField func(key string, value interface{})) {
+	addField("job.id", j.ID)
+	addField("job.type", j.Type)
+	addField("job.attempt", j.Attempt)
+}
+
+// Handler runs jobs.
+type Handler interface {
+	Handle(ctx context.Context, job Job) error
+}
+
+// HandlerFunc is a function implementing Handler.
+type HandlerFunc func(ctx context.Context, job Job) error
+
+// Handle calls f.
+func (f HandlerFunc) Handle(ctx context.Context, job Job) error {
+	return f(ctx, job)
+}
+
+// Options contains the options of a Runner.
+type Options struct {
+	// Workers is the number of jobs run concurrently.
+	Workers int
+
+	// VisibilityTimeout is how long a dequeued job stays invisible to
+	// the other workers. Handlers get a tenth less.
+	VisibilityTimeout time.Duration
+
+	// RetryPolicy is the backoff between attempts and the maximum
+	// number of attempts of a job. Zero MaxAttempts means no limit.
+	RetryPolicy retry.Policy
+
+	// DeadLetters stores the jobs that failed for good.
+	DeadLetters DeadLetterStore
+}
+
+// Option configures a Runner.
+type Option func(*Options)
+
+// Workers sets the number of jobs run concurrently.
+func Workers(n int) Option {
+	return func(opts *Options) {
+		opts.Workers = n
+	}
+}
+
+// VisibilityTimeout sets the visibility timeout of jobs.
+func VisibilityTimeout(d time.Duration) Option {
+	return func(opts *Options) {
+		opts.VisibilityTimeout = d
+	}
+}
+
+// RetryPolicy sets the retry policy of jobs.
+func RetryPolicy(p retry.Policy) Option {
+	return func(opts *Options) {
+		opts.RetryPolicy = p
+	}
+}
+
+// DeadLetters sets the dead-letter store.
+func DeadLetters(store DeadLetterStore) Option {
+	return func(opts *Options) {
+		opts.DeadLetters = store
+	}
+}
+
+// Runner runs jobs with the handlers of their type. It implements
+// async.Runner and async.Closer, and keeps the jobs in memory: the jobs
+// still queued when it is closed are dropped. The jobs running when it is
+// closed are finished, those failing are dead-lettered, even if they
+// could be retried.
+type Runner struct {
+	name    string
+	opts    Options
+	metrics *runnerMetrics
+
+	lock     sync.RWMutex
+	handlers map[string]Handler
+
+	queue  *queue.DelayQueue[*entry]
+	closed bool
+	lastID uint64
+}
+
+// entry is a job in the queue of a runner.
+type entry struct {
+	job Job
+
+	// backoff computes the delays between attempts of the job.
+	backoff func() time.Duration
+
+	// item is the item of the job in the queue, and visibleAt when the
+	// job became visible. Both change when the job is dequeued.
+	item      *queue.DelayQueueItem[*entry]
+	visibleAt time.Time
+}
+
+// NewRunner creates a runner. The name identifies it in traces and
+// metrics.
+func NewRunner(name string, options ...Option) *Runner {
+	opts := Options{
+		Workers:           1,
+		VisibilityTimeout: DefaultVisibilityTimeout,
+		RetryPolicy:       DefaultRetryPolicy,
+	}
+	for _, opt := range options {
+		opt(&opts)
+	}
+	if opts.DeadLetters == nil {
+		opts.DeadLetters = NewMemoryDeadLetterStore()
+	}
+
+	return &Runner{
+		name:     name,
+		opts:     opts,
+		metrics:  newRunnerMetrics(name),
+		handlers: map[string]Handler{},
+		queue:    queue.NewDelayQueue[*entry](),
+	}
+}
+
+// Handle registers the handler of a job type, replacing the previous
+// one.
+func (r *Runner) Handle(jobType string, h Handler) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.handlers[jobType] = h
+}
+
+// Enqueue queues a job and returns its ID. Enqueue returns
+// queue.ErrClosed if the runner is closed.
+func (r *Runner) Enqueue(job Job) (string, error) {
+	if job.ID == "" {
+		job.ID = r.name + "-" + strconv.FormatUint(atomic.AddUint64(&r.lastID, 1), 10)
+	}
+	if job.RunAt.IsZero() {
+		job.RunAt = time.Now()
+	}
+	job.Attempt = 0
+
+	e := &entry{job: job, backoff: r.opts.RetryPolicy.Backoff(), visibleAt: job.RunAt}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	item, err := r.queue.Push(e, job.RunAt)
+	if err != nil {
+		return "", err
+	}
+	e.item = item
+	return job.ID, nil
+}
+
+// Len returns the number of jobs queued or running.
+func (r *Runner) Len() int {
+	return r.queue.Len()
+}
+
+// Run runs the workers until the context is canceled or the runner is
+// closed. The running jobs are finished first: handlers run with a
+// context that is not canceled with ctx, only by their deadline.
+func (r *Runner) Run(ctx context.Context) error {
+	group := async.NewTaskGroup(r.name)
+	for i := 0; i < r.opts.Workers; i++ {
+		group.Run(ctx, async.Named(fmt.Sprintf("%s.worker.%d", r.name, i), async.Func(r.work)))
+	}
+	group.Wait()
+	return nil
+}
+
+// Close stops the workers once their running jobs are finished.
+func (r *Runner) Close(_ context.Context) error {
+	// closed is set before the queue drops the running jobs, so that
+	// their outcome is still recorded
+	r.lock.Lock()
+	r.closed = true
+	r.lock.Unlock()
+	r.queue.Close()
+	return nil
+}
+
+// work runs jobs until the context is canceled or the runner is closed.
+func (r *Runner) work(ctx context.Context) error {
+	for {
+		e, err := r.queue.PopWait(ctx)
+		if err != nil {
+			return nil
+		}
+
+		job, item, visibleAt, ok := r.reserve(e)
+		if !ok {
+			continue
+		}
+		r.process(ctx, e, job, item, visibleAt)
+	}
+}
+
+// reserve queues a dequeued job again at the end of its visibility
+// timeout, and starts its next attempt.
+func (r *Runner) reserve(e *entry) (job Job, item *queue.DelayQueueItem[*entry], visibleAt time.Time, ok bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	item, err := r.queue.Push(e, now.Add(r.opts.VisibilityTimeout))
+	if err != nil {
+		// closed, the job is dropped
+		return job, nil, visibleAt, false
+	}
+	visibleAt = e.visibleAt
+	e.item, e.visibleAt = item, item.GetVisibleAt()
+	e.job.Attempt++
+	return e.job, item, visibleAt, true
+}
+
+// process runs an attempt of a job, then completes, retries or
+// dead-letters the job.
+func (r *Runner) process(ctx context.Context, e *entry, job Job, item *queue.DelayQueueItem[*entry], visibleAt time.Time) {
+	ctx = trace.StartCall(ctx, "job."+job.Type, &job)
+	defer trace.EndCall(ctx)
+
+	times := events.Times{Scheduled: visibleAt, Started: time.Now()}
+	err := trace.SetCallStatus(ctx, r.run(ctx, job, item.GetVisibleAt()))
+	times.Finished = time.Now()
+	durations := times.Durations()
+	trace.AddInfo(ctx, &times, durations)
+	r.metrics.observe(job.Type, durations)
+
+	if err == nil {
+		r.complete(e, job, item, outcomeSuccess)
+		return
+	}
+
+	retryable := orerr.IsRetryable(err)
+	maxAttempts := r.opts.RetryPolicy.MaxAttempts
+	if retryable && (maxAttempts <= 0 || job.Attempt < maxAttempts) && r.retry(ctx, e, job, item, err) {
+		return
+	}
+
+	if !r.complete(e, job, item, outcomeDeadLetter) {
+		return
+	}
+	letter := DeadLetter{Job: job, Err: err, At: time.Now()}
+	log.Warn(ctx, "job dead-lettered", &job, events.NewErrorInfo(err))
+	if err := r.opts.DeadLetters.Put(ctx, letter); err != nil {
+		log.Error(ctx, "failed to store dead-lettered job", &job, events.NewErrorInfo(err))
+	}
+}
+
+// run runs the handler of a job, converting panics into errors. The
+// handler runs until its deadline, before the visibility timeout of the
+// attempt expires at expiry, even if ctx is canceled.
+func (r *Runner) run(ctx context.Context, job Job, expiry time.Time) (err error) {
+	r.lock.RLock()
+	h, ok := r.handlers[job.Type]
+	r.lock.RUnlock()
+	if !ok {
+		return errors.Wrap(ErrNoHandler, job.Type)
+	}
+
+	deadline := expiry.Add(-r.opts.VisibilityTimeout / visibilityMargin)
+	ctx, cancel := context.WithDeadline(context.WithoutCancel(ctx), deadline)
+	defer cancel()
+	defer async.RecoverPanic(ctx, "jobs", &err)
+	return h.Handle(ctx, job)
+}
+
+// complete removes a job from the queue. complete returns false if the
+// visibility timeout of the attempt expired, in which case the job is
+// left to its next attempt.
+func (r *Runner) complete(e *entry, job Job, item *queue.DelayQueueItem[*entry], outcome string) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if !r.queue.Remove(item) && !r.droppedOnClose(e, item) {
+		r.metrics.expired(job.Type)
+		return false
+	}
+	r.metrics.processed(job.Type, outcome)
+	return true
+}
+
+// retry makes a job visible again after the backoff of its attempt.
+// retry returns false if the runner is closed, in which case the job
+// can no longer be retried.
+func (r *Runner) retry(ctx context.Context, e *entry, job Job, item *queue.DelayQueueItem[*entry], err error) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delay := e.backoff()
+	at := time.Now().Add(delay)
+	if r.queue.Update(item, at) != nil {
+		if r.droppedOnClose(e, item) {
+			return false
+		}
+		r.metrics.expired(job.Type)
+		return true
+	}
+	e.visibleAt = at
+	r.metrics.processed(job.Type, outcomeRetry)
+	log.Debug(ctx, "retrying job", &job, log.F{"job.delay": delay.String()}, events.NewErrorInfo(err))
+	return true
+}
+
+// droppedOnClose returns true if the attempt of a job that is no longer
+// queued was dropped by Close rather than dequeued again after its
+// visibility timeout expired. It must be called with the lock held.
+func (r *Runner) droppedOnClose(e *entry, item *queue.DelayQueueItem[*entry]) bool {
+	return r.closed && e.item == item
+}
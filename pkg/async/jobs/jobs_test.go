@@ -0,0 +1,274 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/poll"
+
+	"github.com/grevych/gobox/pkg/async"
+	"github.com/grevych/gobox/pkg/async/jobs"
+	"github.com/grevych/gobox/pkg/orerr"
+	"github.com/grevych/gobox/pkg/retry"
+)
+
+var fast = retry.Policy{MaxAttempts: 3, InitialDelay: time.Millisecond, Multiplier: 2}
+
+// start runs the runner until the test ends.
+func start(t *testing.T, runner *jobs.Runner) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.Check(t, runner.Run(context.Background()))
+	}()
+	t.Cleanup(func() {
+		assert.Check(t, runner.Close(context.Background()))
+		<-done
+	})
+}
+
+// waitForLetters waits for n dead letters in the store.
+func waitForLetters(t *testing.T, store *jobs.MemoryDeadLetterStore, n int) []jobs.DeadLetter {
+	poll.WaitOn(t, func(poll.LogT) poll.Result {
+		if len(store.List()) < n {
+			return poll.Continue("waiting for dead letters")
+		}
+		return poll.Success()
+	}, poll.WithTimeout(5*time.Second))
+	return store.List()
+}
+
+func TestRunner_Success(t *testing.T) {
+	runner := jobs.NewRunner("test", jobs.Workers(2))
+	results := make(chan jobs.Job, 1)
+	runner.Handle("echo", jobs.HandlerFunc(func(ctx context.Context, job jobs.Job) error {
+		results <- job
+		return nil
+	}))
+	start(t, runner)
+
+	id, err := runner.Enqueue(jobs.Job{Type: "echo", Payload: "hello"})
+	assert.NilError(t, err)
+	job := <-results
+	assert.Equal(t, job.ID, id)
+	assert.Equal(t, job.Payload, "hello")
+	assert.Equal(t, job.Attempt, 1)
+	poll.WaitOn(t, func(poll.LogT) poll.Result {
+		if runner.Len() != 0 {
+			return poll.Continue("job still queued")
+		}
+		return poll.Success()
+	})
+}
+
+func TestRunner_RunAt(t *testing.T) {
+	runner := jobs.NewRunner("test")
+	results := make(chan time.Time, 1)
+	runner.Handle("later", jobs.HandlerFunc(func(ctx context.Context, job jobs.Job) error {
+		results <- time.Now()
+		return nil
+	}))
+	start(t, runner)
+
+	at := time.Now().Add(30 * time.Millisecond)
+	_, err := runner.Enqueue(jobs.Job{Type: "later", RunAt: at})
+	assert.NilError(t, err)
+	assert.Assert(t, !(<-results).Before(at))
+}
+
+func TestRunner_Retries(t *testing.T) {
+	store := jobs.NewMemoryDeadLetterStore()
+	runner := jobs.NewRunner("test", jobs.RetryPolicy(fast), jobs.DeadLetters(store))
+
+	var lock sync.Mutex
+	attempts := map[string][]int{}
+	runner.Handle("flaky", jobs.HandlerFunc(func(ctx context.Context, job jobs.Job) error {
+		lock.Lock()
+		defer lock.Unlock()
+		attempts[job.ID] = append(attempts[job.ID], job.Attempt)
+		if job.Payload == "recovers" && job.Attempt == 2 {
+			return nil
+		}
+		return orerr.Retryable(errors.New("flaky"))
+	}))
+	start(t, runner)
+
+	recovers, err := runner.Enqueue(jobs.Job{ID: "recovers", Type: "flaky", Payload: "recovers"})
+	assert.NilError(t, err)
+	fails, err := runner.Enqueue(jobs.Job{ID: "fails", Type: "flaky"})
+	assert.NilError(t, err)
+
+	letters := waitForLetters(t, store, 1)
+	assert.Equal(t, letters[0].Job.ID, fails)
+	assert.Equal(t, letters[0].Job.Attempt, 3)
+	assert.Error(t, letters[0].Err, "flaky")
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.DeepEqual(t, attempts[recovers], []int{1, 2})
+	assert.DeepEqual(t, attempts[fails], []int{1, 2, 3})
+}
+
+func TestRunner_DeadLetters(t *testing.T) {
+	store := jobs.NewMemoryDeadLetterStore()
+	runner := jobs.NewRunner("test", jobs.RetryPolicy(fast), jobs.DeadLetters(store))
+	runner.Handle("broken", jobs.HandlerFunc(func(ctx context.Context, job jobs.Job) error {
+		return errors.New("broken")
+	}))
+	runner.Handle("panics", jobs.HandlerFunc(func(ctx context.Context, job jobs.Job) error {
+		panic("oops")
+	}))
+	start(t, runner)
+
+	for _, jobType := range []string{"broken", "panics", "unknown"} {
+		_, err := runner.Enqueue(jobs.Job{ID: jobType, Type: jobType})
+		assert.NilError(t, err)
+	}
+
+	letters := map[string]jobs.DeadLetter{}
+	for _, letter := range waitForLetters(t, store, 3) {
+		letters[letter.Job.ID] = letter
+		assert.Equal(t, letter.Job.Attempt, 1, "errors that are not retryable are not retried")
+	}
+	assert.Error(t, letters["broken"].Err, "broken")
+	var panicErr *async.PanicError
+	assert.Assert(t, errors.As(letters["panics"].Err, &panicErr))
+	assert.Assert(t, errors.Is(letters["unknown"].Err, jobs.ErrNoHandler))
+
+	assert.Equal(t, len(store.Drain()), 3)
+	assert.Equal(t, len(store.List()), 0)
+}
+
+func TestRunner_VisibilityTimeout(t *testing.T) {
+	store := jobs.NewMemoryDeadLetterStore()
+	runner := jobs.NewRunner("test", jobs.Workers(2), jobs.VisibilityTimeout(20*time.Millisecond), jobs.DeadLetters(store))
+
+	release := make(chan struct{})
+	results := make(chan int, 2)
+	runner.Handle("stuck", jobs.HandlerFunc(func(ctx context.Context, job jobs.Job) error {
+		if job.Attempt == 1 {
+			// ignores the deadline of its context
+			<-release
+			results <- job.Attempt
+			return errors.New("too late")
+		}
+		results <- job.Attempt
+		return nil
+	}))
+	start(t, runner)
+
+	_, err := runner.Enqueue(jobs.Job{Type: "stuck"})
+	assert.NilError(t, err)
+
+	// the job is dequeued again while its first attempt is stuck
+	assert.Equal(t, <-results, 2)
+	close(release)
+	assert.Equal(t, <-results, 1)
+
+	// the outcome of the expired attempt is ignored
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, len(store.List()), 0)
+	assert.Equal(t, runner.Len(), 0)
+}
+
+func TestRunner_HandlerDeadline(t *testing.T) {
+	runner := jobs.NewRunner("test", jobs.VisibilityTimeout(time.Minute))
+	deadlines := make(chan time.Duration, 1)
+	runner.Handle("deadline", jobs.HandlerFunc(func(ctx context.Context, job jobs.Job) error {
+		deadline, ok := ctx.Deadline()
+		assert.Check(t, ok)
+		deadlines <- time.Until(deadline)
+		return nil
+	}))
+	start(t, runner)
+
+	_, err := runner.Enqueue(jobs.Job{Type: "deadline"})
+	assert.NilError(t, err)
+	// the handler has to finish before the job becomes visible again
+	remaining := <-deadlines
+	assert.Assert(t, remaining <= 54*time.Second && remaining > 50*time.Second, remaining)
+}
+
+func TestRunner_FinishesRunningJobs(t *testing.T) {
+	store := jobs.NewMemoryDeadLetterStore()
+	runner := jobs.NewRunner("test", jobs.DeadLetters(store))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	results := make(chan error, 1)
+	runner.Handle("slow", jobs.HandlerFunc(func(ctx context.Context, job jobs.Job) error {
+		close(started)
+		<-release
+		results <- ctx.Err()
+		return nil
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.Check(t, runner.Run(ctx))
+	}()
+
+	_, err := runner.Enqueue(jobs.Job{Type: "slow"})
+	assert.NilError(t, err)
+	<-started
+	cancel()
+
+	select {
+	case <-done:
+		t.Fatal("Run returned before the running job finished")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	assert.NilError(t, <-results, "the handler context is not canceled with Run")
+	<-done
+	assert.Equal(t, runner.Len(), 0)
+	assert.Equal(t, len(store.List()), 0)
+}
+
+func TestRunner_FailsDuringClose(t *testing.T) {
+	store := jobs.NewMemoryDeadLetterStore()
+	runner := jobs.NewRunner("test", jobs.Workers(2), jobs.RetryPolicy(fast), jobs.DeadLetters(store))
+
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	runner.Handle("fails", jobs.HandlerFunc(func(ctx context.Context, job jobs.Job) error {
+		started <- struct{}{}
+		<-release
+		if job.ID == "retryable" {
+			return orerr.Retryable(errors.New("try again"))
+		}
+		return errors.New("broken")
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.Check(t, runner.Run(context.Background()))
+	}()
+
+	for _, id := range []string{"broken", "retryable"} {
+		_, err := runner.Enqueue(jobs.Job{ID: id, Type: "fails"})
+		assert.NilError(t, err)
+	}
+	<-started
+	<-started
+	assert.NilError(t, runner.Close(context.Background()))
+	close(release)
+	<-done
+
+	// the retryable job cannot be retried once the runner is closed
+	letters := store.List()
+	ids := []string{}
+	for _, letter := range letters {
+		ids = append(ids, letter.Job.ID)
+	}
+	sort.Strings(ids)
+	assert.DeepEqual(t, ids, []string{"broken", "retryable"})
+}
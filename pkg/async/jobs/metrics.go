@@ -0,0 +1,78 @@
+// Description: Provides the metrics of the job runner
+
+package jobs
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/grevych/gobox/pkg/app"
+	"github.com/grevych/gobox/pkg/events"
+)
+
+// This section defines the outcomes of the attempts of jobs.
+const (
+	outcomeSuccess    = "success"
+	outcomeRetry      = "retry"
+	outcomeDeadLetter = "dead_letter"
+	outcomeExpired    = "expired"
+)
+
+// jobsProcessed registers the jobs_processed_total metric for counting
+// the attempts of jobs, by outcome.
+var jobsProcessed = promauto.NewCounterVec( // nolint:gochecknoglobals // Why: cleaner to use everywhere
+	prometheus.CounterOpts{
+		Name: "jobs_processed_total",
+		Help: "The number of attempts of jobs, by outcome: success, retry, dead_letter, or expired when the visibility timeout expired first",
+	},
+	[]string{"app", "runner", "type", "outcome"}, // Labels
+)
+
+// jobsWaitSeconds registers the jobs_wait_seconds metric for reporting
+// the time jobs waited for a worker once visible, in seconds.
+var jobsWaitSeconds = promauto.NewHistogramVec( // nolint:gochecknoglobals // Why: cleaner to use everywhere
+	prometheus.HistogramOpts{
+		Name:    "jobs_wait_seconds",
+		Help:    "The time between a job becoming visible and a worker dequeuing it, in seconds",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+	},
+	[]string{"app", "runner", "type"}, // Labels
+)
+
+// jobsServiceSeconds registers the jobs_service_seconds metric for
+// reporting the time handlers spent running jobs, in seconds.
+var jobsServiceSeconds = promauto.NewHistogramVec( // nolint:gochecknoglobals // Why: cleaner to use everywhere
+	prometheus.HistogramOpts{
+		Name:    "jobs_service_seconds",
+		Help:    "The time it took a handler to run an attempt of a job, in seconds",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+	},
+	[]string{"app", "runner", "type"}, // Labels
+)
+
+// runnerMetrics holds the metrics of a single runner.
+type runnerMetrics struct {
+	app  string
+	name string
+}
+
+// newRunnerMetrics creates the metrics of the runner with the given name.
+func newRunnerMetrics(name string) *runnerMetrics {
+	return &runnerMetrics{app: app.Info().Name, name: name}
+}
+
+// observe reports the wait and service time of an attempt.
+func (m *runnerMetrics) observe(jobType string, d *events.Durations) {
+	jobsWaitSeconds.WithLabelValues(m.app, m.name, jobType).Observe(d.WaitSeconds)
+	jobsServiceSeconds.WithLabelValues(m.app, m.name, jobType).Observe(d.ServiceSeconds)
+}
+
+// processed counts an attempt with the given outcome.
+func (m *runnerMetrics) processed(jobType, outcome string) {
+	jobsProcessed.WithLabelValues(m.app, m.name, jobType, outcome).Inc()
+}
+
+// expired counts an attempt that finished after its visibility timeout.
+func (m *runnerMetrics) expired(jobType string) {
+	m.processed(jobType, outcomeExpired)
+}
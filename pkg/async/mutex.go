@@ -0,0 +1,222 @@
+// Description: Provides context-aware read-write and keyed locks
+
+package async
+
+import (
+	"context"
+	"hash/maphash"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/grevych/gobox/pkg/app"
+)
+
+// lockWaitSeconds registers the async_lock_wait_seconds metric for
+// reporting the time spent waiting for a lock, in seconds.
+var lockWaitSeconds = promauto.NewHistogramVec( // nolint:gochecknoglobals // Why: cleaner to use everywhere
+	prometheus.HistogramOpts{
+		Name:    "async_lock_wait_seconds",
+		Help:    "The time spent waiting to acquire a lock, in seconds",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+	},
+	[]string{"app", "lock", "mode", "outcome"}, // Labels
+)
+
+// acquireLock acquires n from sem and reports the time it took.
+func acquireLock(ctx context.Context, sem *semaphore.Weighted, n int64, name, mode string) error {
+	start := time.Now()
+	err := sem.Acquire(ctx, n)
+
+	outcome := "acquired"
+	if err != nil {
+		outcome = "canceled"
+	}
+	lockWaitSeconds.WithLabelValues(app.Info().Name, name, mode, outcome).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// rwMutexMaxReaders is the weight of a writer in a RWMutexWithContext,
+// which is also the maximum number of concurrent readers.
+const rwMutexMaxReaders = 1 << 30
+
+// RWMutexWithContext is a reader/writer lock that supports context
+// cancellation for both readers and writers.
+//
+// A writer waiting for the lock blocks new readers, so writers are not
+// starved by a steady flow of readers.
+//
+// The time spent waiting for the lock is reported in the
+// async_lock_wait_seconds metric, labeled with the name of the lock.
+type RWMutexWithContext struct {
+	name string
+	sem  *semaphore.Weighted
+}
+
+// NewRWMutexWithContext creates a new RWMutexWithContext instance.
+func NewRWMutexWithContext(name string) *RWMutexWithContext {
+	return &RWMutexWithContext{name: name, sem: semaphore.NewWeighted(rwMutexMaxReaders)}
+}
+
+// Lock acquires the mutex for writing, blocking until it is available.
+//
+// Like MutexWithContext.Lock, this function can fail and the caller must
+// not proceed if it returns an error.
+func (m *RWMutexWithContext) Lock(ctx context.Context) error {
+	return acquireLock(ctx, m.sem, rwMutexMaxReaders, m.name, "write")
+}
+
+// Unlock releases the mutex for writing.
+func (m *RWMutexWithContext) Unlock() {
+	m.sem.Release(rwMutexMaxReaders)
+}
+
+// RLock acquires the mutex for reading, blocking while it is held or
+// requested by a writer.
+//
+// Like MutexWithContext.Lock, this function can fail and the caller must
+// not proceed if it returns an error.
+func (m *RWMutexWithContext) RLock(ctx context.Context) error {
+	return acquireLock(ctx, m.sem, 1, m.name, "read")
+}
+
+// RUnlock releases the mutex for reading.
+func (m *RWMutexWithContext) RUnlock() {
+	m.sem.Release(1)
+}
+
+// KeyedMutexOptions contains the options for a KeyedMutex.
+type KeyedMutexOptions struct {
+	// Shards is the number of shards of the map of keys, 32 by default.
+	Shards int
+}
+
+// KeyedMutexOption configures a KeyedMutex.
+type KeyedMutexOption func(*KeyedMutexOptions)
+
+// WithShards sets the number of shards of a KeyedMutex.
+func WithShards(n int) KeyedMutexOption {
+	return func(opts *KeyedMutexOptions) {
+		opts.Shards = n
+	}
+}
+
+// KeyedMutex hands out a lock per key, for example per tenant or per
+// record, that supports context cancellation.
+//
+// Keys are spread over a sharded map to limit contention between
+// unrelated keys. A key is removed from the map as soon as nobody holds
+// or waits for its lock, so idle keys do not use any memory.
+//
+// The time spent waiting for a lock is reported in the
+// async_lock_wait_seconds metric, labeled with the name of the
+// KeyedMutex.
+//
+//	if err := locks.Lock(ctx, accountID); err != nil {
+//	    return err
+//	}
+//	defer locks.Unlock(accountID)
+type KeyedMutex struct {
+	name   string
+	seed   maphash.Seed
+	shards []keyedShard
+}
+
+// keyedShard is a shard of the map of keys of a KeyedMutex.
+type keyedShard struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+// keyedLock is the lock of a key, along with the number of goroutines
+// holding or waiting for it.
+type keyedLock struct {
+	sem  *semaphore.Weighted
+	refs int
+}
+
+// NewKeyedMutex creates a new KeyedMutex instance.
+func NewKeyedMutex(name string, options ...KeyedMutexOption) *KeyedMutex {
+	opts := &KeyedMutexOptions{Shards: 32}
+	for _, o := range options {
+		o(opts)
+	}
+	if opts.Shards < 1 {
+		opts.Shards = 1
+	}
+
+	shards := make([]keyedShard, opts.Shards)
+	for i := range shards {
+		shards[i].locks = map[string]*keyedLock{}
+	}
+	return &KeyedMutex{name: name, seed: maphash.MakeSeed(), shards: shards}
+}
+
+// Lock acquires the lock of key, blocking until it is available.
+//
+// Like MutexWithContext.Lock, this function can fail and the caller must
+// not proceed if it returns an error.
+func (k *KeyedMutex) Lock(ctx context.Context, key string) error {
+	shard := k.shard(key)
+
+	shard.mu.Lock()
+	l, ok := shard.locks[key]
+	if !ok {
+		l = &keyedLock{sem: semaphore.NewWeighted(1)}
+		shard.locks[key] = l
+	}
+	l.refs++
+	shard.mu.Unlock()
+
+	if err := acquireLock(ctx, l.sem, 1, k.name, "write"); err != nil {
+		shard.mu.Lock()
+		shard.release(key, l)
+		shard.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Unlock releases the lock of key. It panics if the key is not locked.
+func (k *KeyedMutex) Unlock(key string) {
+	shard := k.shard(key)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	l, ok := shard.locks[key]
+	if !ok {
+		panic("async: unlock of unlocked key")
+	}
+	l.sem.Release(1)
+	shard.release(key, l)
+}
+
+// Len returns the number of keys locked or waited for.
+func (k *KeyedMutex) Len() int {
+	n := 0
+	for i := range k.shards {
+		shard := &k.shards[i]
+		shard.mu.Lock()
+		n += len(shard.locks)
+		shard.mu.Unlock()
+	}
+	return n
+}
+
+// shard returns the shard of key.
+func (k *KeyedMutex) shard(key string) *keyedShard {
+	return &k.shards[maphash.String(k.seed, key)%uint64(len(k.shards))]
+}
+
+// release drops a reference to the lock of key, removing the key once
+// it is idle. It must be called with the lock of the shard held.
+func (s *keyedShard) release(key string, l *keyedLock) {
+	l.refs--
+	if l.refs == 0 {
+		delete(s.locks, key)
+	}
+}
@@ -0,0 +1,112 @@
+package async_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grevych/gobox/pkg/async"
+	"gotest.tools/v3/assert"
+)
+
+func TestRWMutexWithContext(t *testing.T) {
+	ctx := context.Background()
+	m := async.NewRWMutexWithContext("test")
+
+	// readers share the lock
+	assert.NilError(t, m.RLock(ctx))
+	assert.NilError(t, m.RLock(ctx))
+
+	// writers wait for the readers
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.Assert(t, errors.Is(m.Lock(timeout), context.DeadlineExceeded))
+
+	m.RUnlock()
+	m.RUnlock()
+
+	assert.NilError(t, m.Lock(ctx))
+
+	// readers wait for the writer
+	timeout, cancel = context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.Assert(t, errors.Is(m.RLock(timeout), context.DeadlineExceeded))
+
+	m.Unlock()
+	assert.NilError(t, m.RLock(ctx))
+	m.RUnlock()
+}
+
+func TestRWMutexWithContext_WaitingWriterBlocksReaders(t *testing.T) {
+	ctx := context.Background()
+	m := async.NewRWMutexWithContext("test")
+	assert.NilError(t, m.RLock(ctx))
+
+	locked := make(chan struct{})
+	go func() {
+		assert.Check(t, m.Lock(ctx))
+		close(locked)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.Assert(t, errors.Is(m.RLock(timeout), context.DeadlineExceeded))
+
+	m.RUnlock()
+	<-locked
+	m.Unlock()
+}
+
+func TestKeyedMutex(t *testing.T) {
+	ctx := context.Background()
+	locks := async.NewKeyedMutex("test", async.WithShards(4))
+
+	assert.NilError(t, locks.Lock(ctx, "a"))
+	assert.NilError(t, locks.Lock(ctx, "b"))
+	assert.Equal(t, locks.Len(), 2)
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.Assert(t, errors.Is(locks.Lock(timeout, "a"), context.DeadlineExceeded))
+
+	locks.Unlock("a")
+	locks.Unlock("b")
+	assert.Equal(t, locks.Len(), 0)
+}
+
+func TestKeyedMutex_MutualExclusion(t *testing.T) {
+	ctx := context.Background()
+	locks := async.NewKeyedMutex("test")
+
+	var wg sync.WaitGroup
+	counters := map[string]*atomic.Int32{"a": {}, "b": {}, "c": {}}
+	for i := 0; i < 30; i++ {
+		for key, holders := range counters {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.Check(t, locks.Lock(ctx, key))
+				assert.Check(t, holders.Add(1) == 1)
+				time.Sleep(time.Millisecond)
+				holders.Add(-1)
+				locks.Unlock(key)
+			}()
+		}
+	}
+	wg.Wait()
+
+	// idle keys are cleaned up
+	assert.Equal(t, locks.Len(), 0)
+}
+
+func TestKeyedMutex_UnlockOfUnlockedKey(t *testing.T) {
+	locks := async.NewKeyedMutex("test")
+	defer func() {
+		assert.Equal(t, recover(), "async: unlock of unlocked key")
+	}()
+	locks.Unlock("a")
+}
@@ -0,0 +1,121 @@
+// Description: Provides panic recovery for async tasks
+
+package async
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/grevych/gobox/pkg/app"
+	"github.com/grevych/gobox/pkg/events"
+	"github.com/grevych/gobox/pkg/log"
+	"github.com/grevych/gobox/pkg/trace"
+)
+
+// taskPanics registers the async_task_panics_total metric for counting the
+// panics recovered in TaskGroup tasks.
+var taskPanics = promauto.NewCounterVec( // nolint:gochecknoglobals // Why: cleaner to use everywhere
+	prometheus.CounterOpts{
+		Name: "async_task_panics_total",
+		Help: "The number of panics recovered in async tasks",
+	},
+	[]string{"app", "taskgroup"}, // Labels
+)
+
+// panics registers the async_panics_total metric for counting the panics
+// recovered by RecoverPanic, outside of TaskGroup tasks.
+var panics = promauto.NewCounterVec( // nolint:gochecknoglobals // Why: cleaner to use everywhere
+	prometheus.CounterOpts{
+		Name: "async_panics_total",
+		Help: "The number of panics recovered in async components other than TaskGroup tasks",
+	},
+	[]string{"app", "component"}, // Labels
+)
+
+// PanicError is the error reported for a task that panicked.
+//
+// Info is the panic converted by events.NewErrorInfoFromPanic and always
+// contains the stack of the panic.
+type PanicError struct {
+	Info *events.ErrorInfo
+}
+
+// Error implements the err interface.
+func (e *PanicError) Error() string {
+	return "panic: " + e.Info.Error
+}
+
+// Unwrap returns the panic value if it was an error.
+func (e *PanicError) Unwrap() error {
+	return e.Info.RawError
+}
+
+// MarshalLog logs the panic with its stack.
+func (e *PanicError) MarshalLog(addField func(key string, value interface{})) {
+	e.Info.MarshalLog(addField)
+}
+
+// recoverTask converts the result of recover() into a PanicError, see
+// recoverPanic. If the TaskGroup has Repanic set, the panic is logged and
+// re-raised instead.
+func (t *TaskGroup) recoverTask(ctx context.Context, r interface{}) error {
+	err := recoverPanic(ctx, r)
+	taskPanics.WithLabelValues(app.Info().Name, t.Name).Inc()
+	if t.Repanic {
+		log.Error(ctx, t.Name, events.NewErrorInfo(err))
+		panic(r)
+	}
+	return err
+}
+
+// recoverPanic converts the result of recover() into a PanicError. It
+// records the panic on the span in ctx.
+func recoverPanic(ctx context.Context, r interface{}) *PanicError {
+	v := r
+	// errors do not carry a stack by default, take it from here as the
+	// panicking frames are still on the stack while recovering.
+	if err, ok := r.(error); ok {
+		v = errors.WithStack(err)
+	}
+
+	info := events.NewErrorInfoFromPanic(v)
+	info.Kind = "panic"
+	err := &PanicError{Info: info}
+
+	//nolint:errcheck // Why: only recording the error on the span
+	_ = trace.Error(ctx, err)
+	return err
+}
+
+// RecoverPanic recovers a panic and stores it in err as a PanicError.
+// The panic is recorded on the span in ctx and counted in the
+// async_panics_total metric under the provided component. The component
+// names the kind of caller, like "pool" or "jobs", rather than an
+// instance, to keep the number of series low. It does nothing without a
+// panic.
+//
+// RecoverPanic must be deferred directly, for recover to stop the panic:
+//
+//	func call(ctx context.Context) (err error) {
+//	    defer async.RecoverPanic(ctx, "name", &err)
+//	    ...
+//	}
+func RecoverPanic(ctx context.Context, component string, err *error) {
+	if r := recover(); r != nil {
+		*err = recoverPanic(ctx, r)
+		panics.WithLabelValues(app.Info().Name, component).Inc()
+	}
+}
+
+// runTask runs r, converting panics into errors.
+func (t *TaskGroup) runTask(ctx context.Context, r Runner) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = t.recoverTask(ctx, p)
+		}
+	}()
+	return r.Run(ctx)
+}
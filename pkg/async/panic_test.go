@@ -0,0 +1,81 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gotest.tools/v3/assert"
+
+	"github.com/grevych/gobox/pkg/app"
+)
+
+func TestTaskGroup_RunRecoversPanic(t *testing.T) {
+	panics := taskPanics.WithLabelValues(app.Info().Name, "test_run_panic")
+	before := testutil.ToFloat64(panics)
+
+	tg := TaskGroup{Name: "test_run_panic"}
+	tg.Run(context.Background(), Func(func(ctx context.Context) error {
+		panic("oh no")
+	}))
+	tg.Wait()
+
+	assert.Equal(t, before+1, testutil.ToFloat64(panics))
+}
+
+func TestTaskGroup_LoopRecoversPanic(t *testing.T) {
+	cause := errors.New("oh no")
+	panics := taskPanics.WithLabelValues(app.Info().Name, "test_loop_panic")
+	before := testutil.ToFloat64(panics)
+
+	tg := TaskGroup{Name: "test_loop_panic"}
+	tg.Loop(context.Background(), Func(func(ctx context.Context) error {
+		panic(cause)
+	}))
+
+	err := tg.WaitContext(context.Background())
+	var panicErr *PanicError
+	assert.Assert(t, errors.As(err, &panicErr))
+	assert.Assert(t, errors.Is(err, cause))
+	assert.Equal(t, panicErr.Info.Kind, "panic")
+	assert.Assert(t, len(panicErr.Info.Stack) > 0)
+	assert.ErrorContains(t, err, "panic: oh no")
+	assert.Equal(t, before+1, testutil.ToFloat64(panics))
+}
+
+func TestTaskGroup_Repanic(t *testing.T) {
+	tg := TaskGroup{Name: "test_repanic", Repanic: true}
+	assert.Assert(t, func() (recovered interface{}) {
+		defer func() { recovered = recover() }()
+		//nolint:errcheck // Why: panics
+		tg.runTask(context.Background(), Func(func(ctx context.Context) error {
+			panic("oh no")
+		}))
+		return nil
+	}() == "oh no")
+}
+
+func TestRecoverPanic(t *testing.T) {
+	cause := errors.New("oh no")
+	counter := panics.WithLabelValues(app.Info().Name, "test_recover_panic")
+	before := testutil.ToFloat64(counter)
+
+	call := func(v interface{}) (err error) {
+		defer RecoverPanic(context.Background(), "test_recover_panic", &err)
+		if v != nil {
+			panic(v)
+		}
+		return nil
+	}
+
+	assert.NilError(t, call(nil))
+	err := call(cause)
+	var panicErr *PanicError
+	assert.Assert(t, errors.As(err, &panicErr))
+	assert.Assert(t, errors.Is(err, cause))
+	assert.Equal(t, panicErr.Info.Kind, "panic")
+	assert.Assert(t, len(panicErr.Info.Stack) > 0)
+	assert.Equal(t, before+1, testutil.ToFloat64(counter))
+	assert.Equal(t, testutil.ToFloat64(taskPanics.WithLabelValues(app.Info().Name, "test_recover_panic")), 0.0)
+}
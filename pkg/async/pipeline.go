@@ -0,0 +1,379 @@
+// Description: Provides bounded-concurrency pipeline stages
+
+package async
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/grevych/gobox/pkg/log"
+	"github.com/grevych/gobox/pkg/trace"
+)
+
+// Pipeline connects stages (Map, Filter, Batch and Merge) through bounded
+// channels. The first stage to fail cancels the whole pipeline.
+//
+// The output of the last stage must be consumed until it is closed,
+// which is what Collect does, before calling Wait:
+//
+//	p := async.NewPipeline(ctx)
+//	ids := async.FromSlice(p, accountIDs)
+//	accounts := async.Map(p, "fetch", ids, fetchAccount, async.WithConcurrency(10), async.WithOrder())
+//	active := async.Filter(p, "active", accounts, isActive)
+//	batches := async.Batch(p, "batch", active, 100, time.Second)
+//	for batch := range batches {
+//	    ...
+//	}
+//	err := p.Wait()
+type Pipeline struct {
+	ctx   context.Context
+	group *errgroup.Group
+}
+
+// NewPipeline creates a new pipeline. Its stages are canceled with ctx.
+func NewPipeline(ctx context.Context) *Pipeline {
+	group, ctx := errgroup.WithContext(ctx)
+	return &Pipeline{ctx: ctx, group: group}
+}
+
+// Wait waits for all the stages to finish and returns the first error,
+// as a TaskError tagged with the name of the stage that failed.
+func (p *Pipeline) Wait() error {
+	return p.group.Wait()
+}
+
+// StageOptions contains the options for a pipeline stage.
+type StageOptions struct {
+	// Concurrency is the number of items processed concurrently by
+	// the stage, 1 by default.
+	Concurrency int
+
+	// Ordered preserves the order of the items in the output of the
+	// stage. Otherwise, items are emitted as soon as they are processed.
+	Ordered bool
+
+	// Buffer is the capacity of the output channel of the stage, which
+	// defaults to Concurrency.
+	Buffer int
+}
+
+// StageOption configures a pipeline stage.
+type StageOption func(*StageOptions)
+
+// WithConcurrency sets the number of items processed concurrently by a
+// stage.
+func WithConcurrency(n int) StageOption {
+	return func(opts *StageOptions) {
+		opts.Concurrency = n
+	}
+}
+
+// WithOrder makes a stage preserve the order of the items.
+func WithOrder() StageOption {
+	return func(opts *StageOptions) {
+		opts.Ordered = true
+	}
+}
+
+// WithBuffer sets the capacity of the output channel of a stage.
+func WithBuffer(n int) StageOption {
+	return func(opts *StageOptions) {
+		opts.Buffer = n
+	}
+}
+
+// newStageOptions applies options over the defaults.
+func newStageOptions(options []StageOption) *StageOptions {
+	opts := &StageOptions{Concurrency: 1, Buffer: -1}
+	for _, o := range options {
+		o(opts)
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	if opts.Buffer < 0 {
+		opts.Buffer = opts.Concurrency
+	}
+	return opts
+}
+
+// FromSlice returns a channel that emits items into the pipeline. It
+// runs as a stage named "source".
+func FromSlice[T any](p *Pipeline, items []T) <-chan T {
+	out := make(chan T)
+	p.run("source", func(ctx context.Context) error {
+		defer close(out)
+		for _, item := range items {
+			if err := send(ctx, out, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return out
+}
+
+// Collect consumes the output of a pipeline and returns it along with
+// the result of Wait.
+func Collect[T any](p *Pipeline, in <-chan T) ([]T, error) {
+	items := []T{}
+	for item := range in {
+		items = append(items, item)
+	}
+	if err := p.Wait(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Map is a stage that transforms the items of in with fn.
+func Map[T, U any](p *Pipeline, name string, in <-chan T, fn func(ctx context.Context, item T) (U, error),
+	opts ...StageOption) <-chan U {
+	return stage(p, name, in, newStageOptions(opts), func(ctx context.Context, item T) (U, bool, error) {
+		u, err := fn(ctx, item)
+		return u, true, err
+	})
+}
+
+// Filter is a stage that only keeps the items of in for which fn returns
+// true.
+func Filter[T any](p *Pipeline, name string, in <-chan T, fn func(ctx context.Context, item T) (bool, error),
+	opts ...StageOption) <-chan T {
+	return stage(p, name, in, newStageOptions(opts), func(ctx context.Context, item T) (T, bool, error) {
+		keep, err := fn(ctx, item)
+		return item, keep, err
+	})
+}
+
+// Batch is a stage that groups the items of in into batches of up to
+// size items. When maxWait is positive, an incomplete batch is emitted
+// after waiting maxWait for it to fill up.
+//
+// Only the Buffer option applies to Batch.
+func Batch[T any](p *Pipeline, name string, in <-chan T, size int, maxWait time.Duration,
+	opts ...StageOption) <-chan []T {
+	o := newStageOptions(opts)
+	out := make(chan []T, o.Buffer)
+
+	p.run(name, func(ctx context.Context) error {
+		defer close(out)
+
+		var batch []T
+		var timeout <-chan time.Time
+		flush := func() error {
+			timeout = nil
+			if len(batch) == 0 {
+				return nil
+			}
+			b := batch
+			batch = nil
+			return send(ctx, out, b)
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-timeout:
+				if err := flush(); err != nil {
+					return err
+				}
+			case item, ok := <-in:
+				if !ok {
+					return flush()
+				}
+				if len(batch) == 0 && maxWait > 0 {
+					timeout = time.After(maxWait)
+				}
+				batch = append(batch, item)
+				if len(batch) >= size {
+					if err := flush(); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	})
+	return out
+}
+
+// Merge is a stage that emits the items of all the inputs, in no
+// particular order.
+//
+// Only the Buffer option applies to Merge.
+func Merge[T any](p *Pipeline, name string, ins []<-chan T, opts ...StageOption) <-chan T {
+	o := newStageOptions(opts)
+	out := make(chan T, o.Buffer)
+
+	p.run(name, func(ctx context.Context) error {
+		defer close(out)
+
+		g, ctx := errgroup.WithContext(ctx)
+		for _, in := range ins {
+			g.Go(func() error {
+				for {
+					item, ok, err := receive(ctx, in)
+					if err != nil || !ok {
+						return err
+					}
+					if err := send(ctx, out, item); err != nil {
+						return err
+					}
+				}
+			})
+		}
+		return g.Wait()
+	})
+	return out
+}
+
+// run runs a stage of the pipeline under its own span.
+func (p *Pipeline) run(name string, fn func(ctx context.Context) error) {
+	p.group.Go(func() error {
+		ctx := trace.StartSpan(p.ctx, name)
+		defer trace.End(ctx)
+
+		if err := fn(ctx); err != nil {
+			//nolint:errcheck // Why: only recording the error on the span
+			_ = trace.Error(ctx, err)
+			return &TaskError{Task: name, Err: err}
+		}
+		return nil
+	})
+}
+
+// stageFunc processes an item and returns the item to emit, if any.
+type stageFunc[T, U any] func(ctx context.Context, item T) (U, bool, error)
+
+// stageResult is the result of processing an item.
+type stageResult[U any] struct {
+	value U
+	keep  bool
+	err   error
+}
+
+// stage runs fn over the items of in according to opts.
+func stage[T, U any](p *Pipeline, name string, in <-chan T, opts *StageOptions, fn stageFunc[T, U]) <-chan U {
+	out := make(chan U, opts.Buffer)
+	p.run(name, func(ctx context.Context) error {
+		defer close(out)
+		trace.AddInfo(ctx, log.F{
+			"async.pipeline.concurrency": opts.Concurrency,
+			"async.pipeline.ordered":     opts.Ordered,
+		})
+
+		if opts.Ordered {
+			return stageOrdered(ctx, name, in, out, opts.Concurrency, fn)
+		}
+		return stageUnordered(ctx, name, in, out, opts.Concurrency, fn)
+	})
+	return out
+}
+
+// stageUnordered processes the items of in with a fixed number of
+// workers, emitting them as soon as they are processed.
+func stageUnordered[T, U any](ctx context.Context, name string, in <-chan T, out chan<- U, concurrency int,
+	fn stageFunc[T, U]) error {
+	g, ctx := errgroup.WithContext(ctx)
+	for i := 0; i < concurrency; i++ {
+		g.Go(func() error {
+			for {
+				item, ok, err := receive(ctx, in)
+				if err != nil || !ok {
+					return err
+				}
+				u, keep, err := callStage(ctx, name, fn, item)
+				if err != nil {
+					return err
+				}
+				if keep {
+					if err := send(ctx, out, u); err != nil {
+						return err
+					}
+				}
+			}
+		})
+	}
+	return g.Wait()
+}
+
+// stageOrdered processes up to concurrency items of in at a time and
+// emits them in the order they were received.
+func stageOrdered[T, U any](ctx context.Context, name string, in <-chan T, out chan<- U, concurrency int,
+	fn stageFunc[T, U]) error {
+	g, ctx := errgroup.WithContext(ctx)
+
+	// pending holds the results of the items being processed, in order.
+	pending := make(chan chan stageResult[U], concurrency)
+	sem := make(chan struct{}, concurrency)
+
+	g.Go(func() error {
+		defer close(pending)
+		for {
+			item, ok, err := receive(ctx, in)
+			if err != nil || !ok {
+				return err
+			}
+			if err := send(ctx, sem, struct{}{}); err != nil {
+				return err
+			}
+
+			res := make(chan stageResult[U], 1)
+			if err := send(ctx, pending, res); err != nil {
+				<-sem
+				return err
+			}
+			g.Go(func() error {
+				defer func() { <-sem }()
+				u, keep, err := callStage(ctx, name, fn, item)
+				res <- stageResult[U]{value: u, keep: keep, err: err}
+				return nil
+			})
+		}
+	})
+
+	g.Go(func() error {
+		for res := range pending {
+			r := <-res
+			if r.err != nil {
+				return r.err
+			}
+			if r.keep {
+				if err := send(ctx, out, r.value); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return g.Wait()
+}
+
+// callStage calls fn, converting panics into errors.
+func callStage[T, U any](ctx context.Context, name string, fn stageFunc[T, U], item T) (u U, keep bool, err error) {
+	defer RecoverPanic(ctx, "pipeline", &err)
+	return fn(ctx, item)
+}
+
+// receive receives an item from in, unless ctx is done first.
+func receive[T any](ctx context.Context, in <-chan T) (T, bool, error) {
+	select {
+	case item, ok := <-in:
+		return item, ok, nil
+	case <-ctx.Done():
+		var zero T
+		return zero, false, ctx.Err()
+	}
+}
+
+// send sends an item to out, unless ctx is done first.
+func send[T any](ctx context.Context, out chan<- T, item T) error {
+	select {
+	case out <- item:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,161 @@
+package async_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grevych/gobox/pkg/async"
+	"gotest.tools/v3/assert"
+)
+
+func numbers(n int) []int {
+	items := make([]int, n)
+	for i := range items {
+		items[i] = i
+	}
+	return items
+}
+
+// double doubles an item after sleeping longer for the first items, so
+// that unordered stages would reorder them.
+func double(_ context.Context, i int) (int, error) {
+	time.Sleep(time.Duration(10-i%10) * time.Millisecond)
+	return i * 2, nil
+}
+
+func TestMap_Ordered(t *testing.T) {
+	p := async.NewPipeline(context.Background())
+	out := async.Map(p, "double", async.FromSlice(p, numbers(30)), double,
+		async.WithConcurrency(5), async.WithOrder())
+
+	items, err := async.Collect(p, out)
+	assert.NilError(t, err)
+
+	expected := []int{}
+	for _, i := range numbers(30) {
+		expected = append(expected, i*2)
+	}
+	assert.DeepEqual(t, items, expected)
+}
+
+func TestMap_ConcurrencyLimit(t *testing.T) {
+	var running, peak atomic.Int32
+	fn := func(_ context.Context, i int) (int, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return i, nil
+	}
+
+	for _, ordered := range []bool{false, true} {
+		peak.Store(0)
+		opts := []async.StageOption{async.WithConcurrency(3)}
+		if ordered {
+			opts = append(opts, async.WithOrder())
+		}
+
+		p := async.NewPipeline(context.Background())
+		items, err := async.Collect(p, async.Map(p, "limited", async.FromSlice(p, numbers(50)), fn, opts...))
+		assert.NilError(t, err)
+		assert.Equal(t, len(items), 50)
+		assert.Assert(t, peak.Load() <= 3, "ordered: %v, peak: %d", ordered, peak.Load())
+	}
+}
+
+func TestFilter(t *testing.T) {
+	p := async.NewPipeline(context.Background())
+	even := async.Filter(p, "even", async.FromSlice(p, numbers(10)), func(_ context.Context, i int) (bool, error) {
+		return i%2 == 0, nil
+	}, async.WithConcurrency(4))
+
+	items, err := async.Collect(p, even)
+	assert.NilError(t, err)
+	sort.Ints(items)
+	assert.DeepEqual(t, items, []int{0, 2, 4, 6, 8})
+}
+
+func TestBatch(t *testing.T) {
+	p := async.NewPipeline(context.Background())
+	batches, err := async.Collect(p, async.Batch(p, "batch", async.FromSlice(p, numbers(7)), 3, 0))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, batches, [][]int{{0, 1, 2}, {3, 4, 5}, {6}})
+}
+
+func TestBatch_MaxWait(t *testing.T) {
+	p := async.NewPipeline(context.Background())
+	in := make(chan int)
+	out := async.Batch(p, "batch", in, 10, 10*time.Millisecond)
+
+	in <- 1
+	in <- 2
+	assert.DeepEqual(t, <-out, []int{1, 2})
+
+	close(in)
+	_, ok := <-out
+	assert.Assert(t, !ok)
+	assert.NilError(t, p.Wait())
+}
+
+func TestMerge(t *testing.T) {
+	p := async.NewPipeline(context.Background())
+	merged := async.Merge(p, "merge", []<-chan int{
+		async.FromSlice(p, []int{1, 2, 3}),
+		async.FromSlice(p, []int{4, 5}),
+	})
+
+	items, err := async.Collect(p, merged)
+	assert.NilError(t, err)
+	sort.Ints(items)
+	assert.DeepEqual(t, items, []int{1, 2, 3, 4, 5})
+}
+
+func TestPipeline_CancelOnFirstError(t *testing.T) {
+	var processed atomic.Int32
+	p := async.NewPipeline(context.Background())
+	failing := async.Map(p, "failing", async.FromSlice(p, numbers(1000)), func(_ context.Context, i int) (int, error) {
+		processed.Add(1)
+		if i == 5 {
+			return 0, errors.New("boom")
+		}
+		return i, nil
+	}, async.WithOrder())
+	out := async.Map(p, "next", failing, double)
+
+	_, err := async.Collect(p, out)
+	assert.Error(t, err, "failing: boom")
+	assert.Assert(t, processed.Load() < 1000)
+}
+
+func TestPipeline_Panic(t *testing.T) {
+	p := async.NewPipeline(context.Background())
+	out := async.Map(p, "panicking", async.FromSlice(p, numbers(3)), func(_ context.Context, i int) (int, error) {
+		panic("oops")
+	}, async.WithConcurrency(2))
+
+	_, err := async.Collect(p, out)
+	var panicErr *async.PanicError
+	assert.Assert(t, errors.As(err, &panicErr))
+}
+
+func TestFromSlice_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p := async.NewPipeline(ctx)
+	async.FromSlice(p, numbers(3))
+
+	err := p.Wait()
+	var taskErr *async.TaskError
+	assert.Assert(t, errors.As(err, &taskErr))
+	assert.Equal(t, taskErr.Task, "source")
+	assert.Assert(t, errors.Is(err, context.Canceled))
+}
@@ -0,0 +1,180 @@
+// Description: Provides the queue of work waiting for a worker
+
+package pool
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/grevych/gobox/pkg/orerr"
+	"github.com/grevych/gobox/pkg/queue"
+)
+
+// backlog is the queue of units waiting for a worker.
+//
+// By default it is a buffered channel, taken in order. When the pool is
+// prioritized, units are kept in a queue.PriorityQueue instead: slots
+// bounds the number of units in the queue and items counts them, so
+// that both can be waited on like the channel.
+//
+// Either way, the ScheduleBehavior of the pool sends units to a channel
+// with room for BufferLength units: units itself, or slots.
+type backlog struct {
+	units   chan unit
+	metrics *poolMetrics
+
+	priorities *queue.PriorityQueue
+	slots      chan unit
+	items      chan struct{}
+	epoch      time.Time
+	aging      time.Duration
+}
+
+// newBacklog creates the backlog of a pool.
+func newBacklog(opts *Options, metrics *poolMetrics) *backlog {
+	if !opts.Prioritized {
+		return &backlog{units: make(chan unit, opts.BufferLength), metrics: metrics}
+	}
+
+	// there is no handing a unit over to an idle worker, make room for
+	// at least one
+	size := opts.BufferLength
+	if size < 1 {
+		size = 1
+	}
+	aging := opts.Aging
+	if aging <= 0 {
+		aging = DefaultAging
+	}
+	return &backlog{
+		metrics:    metrics,
+		priorities: queue.NewPriorityQueue(queue.WithCapacity(uint(size))),
+		slots:      make(chan unit, size),
+		items:      make(chan struct{}, size),
+		epoch:      time.Now(),
+		aging:      aging,
+	}
+}
+
+// schedule queues u with the schedule behavior of the pool. u counts as
+// queued while the behavior waits for room.
+func (b *backlog) schedule(ctx context.Context, behavior ScheduleBehavior, u unit) error {
+	queue := b.units
+	if b.priorities != nil {
+		queue = b.slots
+	}
+
+	p := &pending{unit: u, metrics: b.metrics}
+	b.enqueued(u)
+	err := behavior(ctx, queue, p)
+	if p.rejected {
+		b.dequeued(u)
+		return err
+	}
+	if b.priorities != nil {
+		// the behavior took a slot for u
+		u.Context = ctx
+		b.push(u)
+	}
+	return err
+}
+
+// push adds u to the priority queue, once it has a slot. u is already
+// counted as queued.
+//
+// The age of a unit is folded into its key: a unit scheduled one aging
+// period later than another has the same key as the other unit one
+// priority lower. The order of two units therefore never changes while
+// they wait, and no priority has to be updated as time passes. Like the
+// aging of queue.PriorityQueue, the key saturates at the bounds of int64.
+func (b *backlog) push(u unit) {
+	key := saturatingAdd(saturatingMul(int64(u.Priority), int64(b.aging)), int64(u.Scheduled.Sub(b.epoch)))
+
+	//nolint:errcheck // Why: the slot guarantees there is room
+	_, _ = b.priorities.Push(u, key)
+	b.items <- struct{}{}
+}
+
+// saturatingMul returns a*b, clamped to the bounds of int64. b must be
+// positive.
+func saturatingMul(a, b int64) int64 {
+	switch {
+	case a > math.MaxInt64/b:
+		return math.MaxInt64
+	case a < math.MinInt64/b:
+		return math.MinInt64
+	}
+	return a * b
+}
+
+// saturatingAdd returns a+b, clamped to the bounds of int64.
+func saturatingAdd(a, b int64) int64 {
+	switch {
+	case b > 0 && a > math.MaxInt64-b:
+		return math.MaxInt64
+	case b < 0 && a < math.MinInt64-b:
+		return math.MinInt64
+	}
+	return a + b
+}
+
+// receive waits for the next unit, until ctx is done or done is closed.
+func (b *backlog) receive(ctx context.Context, done <-chan struct{}) (unit, bool) {
+	// one of the two is nil, and never ready
+	select {
+	case u := <-b.units:
+		ctx := u.Context
+		u = u.Runner.(*pending).unit
+		u.Context = ctx
+		b.dequeued(u)
+		return u, true
+	case <-b.items:
+		u := b.priorities.Pop().GetData().(unit)
+		<-b.slots
+		b.dequeued(u)
+		return u, true
+	case <-done:
+		return unit{}, false
+	case <-ctx.Done():
+		return unit{}, false
+	}
+}
+
+// len returns the number of units waiting.
+func (b *backlog) len() int {
+	if b.priorities == nil {
+		return len(b.units)
+	}
+	return len(b.items)
+}
+
+// enqueued records that a unit was queued.
+func (b *backlog) enqueued(u unit) {
+	b.metrics.queued(u.Priority, 1)
+}
+
+// dequeued records that a unit was taken by a worker.
+func (b *backlog) dequeued(u unit) {
+	b.metrics.queued(u.Priority, -1)
+}
+
+// pending is the runner handed to the ScheduleBehavior of a pool in place
+// of the scheduled one. The behavior only runs it when it does not queue
+// it.
+type pending struct {
+	unit
+	metrics  *poolMetrics
+	rejected bool
+}
+
+// Run runs the scheduled runner right away, as it was not queued.
+func (p *pending) Run(ctx context.Context) error {
+	p.rejected = true
+	var limit orerr.LimitExceededError
+	if errors.As(ctx.Err(), &limit) {
+		p.metrics.rejections.Inc()
+	}
+	return p.Runner.Run(ctx)
+}
@@ -0,0 +1,56 @@
+package pool
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/grevych/gobox/pkg/async"
+)
+
+func TestBacklog_Aging(t *testing.T) {
+	opts := &Options{Prioritized: true, Aging: 10 * time.Second, BufferLength: 10}
+	b := newBacklog(opts, newPoolMetrics("test_backlog_aging", true))
+	now := b.epoch.Add(time.Minute)
+
+	// the example of the Prioritized documentation
+	for _, u := range []unit{
+		{Priority: PriorityLow, Scheduled: now.Add(-10 * time.Second)},
+		{Priority: PriorityHigh, Scheduled: now},
+		{Priority: PriorityLow, Scheduled: now.Add(-30 * time.Second)},
+	} {
+		u.Runner = async.Func(func(context.Context) error { return nil })
+		assert.NilError(t, b.schedule(context.Background(), WaitWhenFull, u))
+	}
+
+	var waited []time.Duration
+	for i := 0; i < 3; i++ {
+		u, ok := b.receive(context.Background(), nil)
+		assert.Assert(t, ok)
+		waited = append(waited, now.Sub(u.Scheduled))
+	}
+	assert.DeepEqual(t, waited, []time.Duration{30 * time.Second, 0, 10 * time.Second})
+}
+
+func TestBacklog_AgingSaturates(t *testing.T) {
+	opts := &Options{Prioritized: true, Aging: 10 * time.Second, BufferLength: 10}
+	b := newBacklog(opts, newPoolMetrics("test_backlog_aging_saturates", true))
+
+	// the keys of extreme priorities would overflow without saturation
+	for _, priority := range []Priority{math.MaxInt, PriorityNormal, math.MinInt} {
+		u := unit{Priority: priority, Scheduled: b.epoch.Add(time.Minute)}
+		u.Runner = async.Func(func(context.Context) error { return nil })
+		assert.NilError(t, b.schedule(context.Background(), WaitWhenFull, u))
+	}
+
+	var priorities []Priority
+	for i := 0; i < 3; i++ {
+		u, ok := b.receive(context.Background(), nil)
+		assert.Assert(t, ok)
+		priorities = append(priorities, u.Priority)
+	}
+	assert.DeepEqual(t, priorities, []Priority{math.MinInt, PriorityNormal, math.MaxInt})
+}
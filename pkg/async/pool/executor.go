@@ -0,0 +1,228 @@
+// Description: Provides a generic, result-returning pool
+
+package pool
+
+import (
+	"context"
+	"sync"
+
+	"github.com/grevych/gobox/pkg/async"
+	"github.com/grevych/gobox/pkg/orerr"
+	"github.com/grevych/gobox/pkg/trace"
+)
+
+// Task is work submitted to an Executor.
+type Task[T any] struct {
+	// Context is the context the task was submitted with.
+	Context context.Context
+
+	// Name is the name of the task.
+	Name string
+
+	// Func is the function of the task.
+	Func func(ctx context.Context) (T, error)
+}
+
+// Executor runs functions on a Pool and returns their results through
+// futures. It is the supported replacement for calling Schedule
+// directly.
+//
+// It accepts the same options as New: Size (or ConstantSize),
+// ResizeEvery, BufferLength, Name and a ScheduleBehavior, RejectWhenFull
+// or WaitWhenFull.
+//
+//	e := pool.NewExecutor[*Account](ctx, pool.ConstantSize(10), pool.RejectWhenFull)
+//
+//	f, err := e.Submit(ctx, "load-account", func(ctx context.Context) (*Account, error) {
+//	    return store.Load(ctx, id)
+//	})
+//	if err != nil {
+//	    return err // the pool is full or closed
+//	}
+//	account, err := async.Await(ctx, f)
+type Executor[T any] struct {
+	pool *Pool
+
+	mu       sync.Mutex
+	closing  bool
+	inflight int
+	drained  chan struct{}
+
+	// unstarted holds the tasks dropped while closing.
+	unstarted []Task[T]
+}
+
+// NewExecutor creates a new Executor and the Pool it runs on. Call Close
+// to release its resources.
+func NewExecutor[T any](ctx context.Context, options ...Option) *Executor[T] {
+	return &Executor[T]{
+		pool:    New(ctx, options...),
+		drained: make(chan struct{}),
+	}
+}
+
+// Submit schedules fn and returns a future for its result.
+//
+// fn runs under its own span, a child of the span in ctx, with ctx as
+// its parent context. A panic in fn is recovered and reported as an
+// async.PanicError by the future.
+//
+// If the work cannot be scheduled, because ctx is done, the pool is full
+// (with RejectWhenFull, as an orerr.LimitExceededError) or the pool is
+// closed (as an orerr.ShutdownError), Submit returns the error and no
+// future.
+func (e *Executor[T]) Submit(ctx context.Context, name string, fn func(ctx context.Context) (T, error)) (*async.Future[T],
+	error) {
+	return e.SubmitPriority(ctx, PriorityNormal, name, fn)
+}
+
+// SubmitPriority schedules fn like Submit, with the given priority. The
+// priority is ignored unless the pool is Prioritized.
+func (e *Executor[T]) SubmitPriority(ctx context.Context, priority Priority, name string,
+	fn func(ctx context.Context) (T, error)) (*async.Future[T], error) {
+	e.mu.Lock()
+	if e.closing {
+		e.mu.Unlock()
+		return nil, &orerr.ShutdownError{Err: context.Canceled}
+	}
+	e.inflight++
+	e.mu.Unlock()
+
+	// stop waiting for room in the queue, or running the task, when the
+	// pool shuts down.
+	runCtx, cancel := orerr.CancelWithError(ctx)
+	stop := context.AfterFunc(e.pool.context, func() {
+		cancel(&orerr.ShutdownError{Err: context.Canceled})
+	})
+
+	f, complete := async.NewFuture[T](name, func() { cancel(nil) })
+	j := &job[T]{
+		task:     Task[T]{Context: ctx, Name: name, Func: fn},
+		pool:     e.pool.context,
+		complete: complete,
+		skipped:  e.skipped,
+		release: func() {
+			stop()
+			cancel(nil)
+			e.done()
+		},
+	}
+
+	if err := e.pool.schedule(runCtx, priority, j); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Close stops accepting work and waits for the submitted work to finish,
+// or for ctx to be done. It then stops the pool, canceling the work
+// still running, and returns the work that was never started, whose
+// futures fail with an orerr.ShutdownError.
+//
+// It returns ctx.Err() if the submitted work did not finish in time.
+func (e *Executor[T]) Close(ctx context.Context) ([]Task[T], error) {
+	e.mu.Lock()
+	e.closing = true
+	if e.inflight == 0 {
+		e.closeDrained()
+	}
+	e.mu.Unlock()
+
+	var err error
+	select {
+	case <-e.drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	e.pool.Close()
+
+	// once the pool is closed, every task left is either queued, or
+	// about to be queued or rejected by a blocked Submit. They are all
+	// skipped, as their context is canceled with the pool.
+	for {
+		u, ok := e.pool.queue.receive(context.Background(), e.drained)
+		if !ok {
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			return e.unstarted, err
+		}
+		//nolint:errcheck // Why: the error is reported by the future
+		_ = u.Runner.Run(u.Context)
+	}
+}
+
+// skipped records a task that was never started, if the executor is
+// closing.
+func (e *Executor[T]) skipped(task Task[T]) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closing {
+		e.unstarted = append(e.unstarted, task)
+	}
+}
+
+// done records that a submitted task is finished. It closes drained once
+// the executor is closing and nothing is left.
+func (e *Executor[T]) done() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.inflight--
+	if e.closing && e.inflight == 0 {
+		e.closeDrained()
+	}
+}
+
+// closeDrained closes the drained channel once. It must be called with
+// the lock held.
+func (e *Executor[T]) closeDrained() {
+	select {
+	case <-e.drained:
+	default:
+		close(e.drained)
+	}
+}
+
+// job is the async.Runner scheduled on the pool for a task.
+type job[T any] struct {
+	task     Task[T]
+	pool     context.Context
+	complete func(T, error)
+	skipped  func(Task[T])
+	release  func()
+}
+
+// Run runs the task, unless ctx is already done or the pool is closed,
+// in which case it fails the future. It returns the error of the task,
+// which the pool counts toward its error rate.
+func (j *job[T]) Run(ctx context.Context) error {
+	defer j.release()
+
+	err := ctx.Err()
+	if err == nil {
+		err = j.pool.Err()
+	}
+	if err != nil {
+		var zero T
+		j.complete(zero, err)
+		j.skipped(j.task)
+		return err
+	}
+
+	ctx = trace.StartSpan(ctx, j.task.Name)
+	defer trace.End(ctx)
+
+	v, err := j.call(ctx)
+	//nolint:errcheck // Why: only recording the error on the span
+	_ = trace.Error(ctx, err)
+	j.complete(v, err)
+	return err
+}
+
+// call calls the function of the task, converting panics into errors.
+func (j *job[T]) call(ctx context.Context) (v T, err error) {
+	defer async.RecoverPanic(ctx, "pool", &err)
+	return j.task.Func(ctx)
+}
@@ -0,0 +1,154 @@
+package pool_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grevych/gobox/pkg/async"
+	"github.com/grevych/gobox/pkg/async/pool"
+	"github.com/grevych/gobox/pkg/orerr"
+	"gotest.tools/v3/assert"
+)
+
+func TestExecutor_Submit(t *testing.T) {
+	ctx := context.Background()
+	e := pool.NewExecutor[int](ctx, pool.ConstantSize(4))
+
+	futures := []*async.Future[int]{}
+	for i := 0; i < 20; i++ {
+		f, err := e.Submit(ctx, "square", func(context.Context) (int, error) {
+			return i * i, nil
+		})
+		assert.NilError(t, err)
+		futures = append(futures, f)
+	}
+
+	values, err := async.AwaitAll(ctx, futures...)
+	assert.NilError(t, err)
+	for i, v := range values {
+		assert.Equal(t, v, i*i)
+	}
+
+	pending, err := e.Close(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, len(pending), 0)
+}
+
+func TestExecutor_ErrorsAndPanics(t *testing.T) {
+	ctx := context.Background()
+	e := pool.NewExecutor[int](ctx, pool.ConstantSize(1))
+	defer e.Close(ctx) //nolint:errcheck // Why: test
+
+	failing, err := e.Submit(ctx, "failing", func(context.Context) (int, error) {
+		return 0, errors.New("boom")
+	})
+	assert.NilError(t, err)
+	_, err = async.Await(ctx, failing)
+	assert.Error(t, err, "failing: boom")
+
+	panicking, err := e.Submit(ctx, "panicking", func(context.Context) (int, error) {
+		panic("oops")
+	})
+	assert.NilError(t, err)
+	_, err = async.Await(ctx, panicking)
+	var panicErr *async.PanicError
+	assert.Assert(t, errors.As(err, &panicErr))
+	assert.Equal(t, panicErr.Info.Kind, "panic")
+	assert.Assert(t, len(panicErr.Info.Stack) > 0)
+}
+
+func TestExecutor_RejectWhenFull(t *testing.T) {
+	ctx := context.Background()
+	e := pool.NewExecutor[int](ctx, pool.ConstantSize(1), pool.BufferLength(1), pool.RejectWhenFull)
+
+	release := make(chan struct{})
+	block := func(ctx context.Context) (int, error) {
+		select {
+		case <-release:
+			return 1, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+
+	// one running, one queued
+	running, err := e.Submit(ctx, "running", block)
+	assert.NilError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	queued, err := e.Submit(ctx, "queued", block)
+	assert.NilError(t, err)
+
+	_, err = e.Submit(ctx, "rejected", block)
+	assert.Assert(t, errors.As(err, &orerr.LimitExceededError{}))
+
+	close(release)
+	_, err = async.AwaitAll(ctx, running, queued)
+	assert.NilError(t, err)
+
+	_, err = e.Close(ctx)
+	assert.NilError(t, err)
+}
+
+func TestExecutor_CloseReturnsPendingWork(t *testing.T) {
+	ctx := context.Background()
+	e := pool.NewExecutor[int](ctx, pool.ConstantSize(1))
+
+	started := make(chan struct{})
+	running, err := e.Submit(ctx, "running", func(ctx context.Context) (int, error) {
+		close(started)
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	assert.NilError(t, err)
+	<-started
+
+	queued := []*async.Future[int]{}
+	for i := 0; i < 3; i++ {
+		f, err := e.Submit(ctx, "queued", func(context.Context) (int, error) {
+			return i, nil
+		})
+		assert.NilError(t, err)
+		queued = append(queued, f)
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	pending, err := e.Close(timeout)
+	assert.Assert(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, len(pending), 3)
+	assert.Equal(t, pending[0].Name, "queued")
+
+	// the running task is canceled, the queued ones fail
+	_, err = async.Await(ctx, running)
+	assert.Assert(t, errors.As(err, new(*orerr.ShutdownError)))
+	_, err = async.AwaitAll(ctx, queued...)
+	assert.Assert(t, errors.As(err, new(*orerr.ShutdownError)))
+
+	// no more work is accepted
+	_, err = e.Submit(ctx, "late", func(context.Context) (int, error) { return 0, nil })
+	assert.Assert(t, errors.As(err, new(*orerr.ShutdownError)))
+}
+
+func TestExecutor_CloseWaitsForWork(t *testing.T) {
+	ctx := context.Background()
+	e := pool.NewExecutor[int](ctx, pool.ConstantSize(2))
+
+	futures := []*async.Future[int]{}
+	for i := 0; i < 6; i++ {
+		f, err := e.Submit(ctx, "slow", func(context.Context) (int, error) {
+			time.Sleep(5 * time.Millisecond)
+			return i, nil
+		})
+		assert.NilError(t, err)
+		futures = append(futures, f)
+	}
+
+	pending, err := e.Close(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, len(pending), 0)
+
+	_, err = async.AwaitAll(ctx, futures...)
+	assert.NilError(t, err)
+}
@@ -0,0 +1,132 @@
+// Description: Provides the metrics of the async pool
+
+package pool
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/grevych/gobox/pkg/app"
+	"github.com/grevych/gobox/pkg/events"
+)
+
+// poolQueueDepth registers the async_pool_queue_depth metric for
+// reporting the number of tasks waiting for a worker.
+var poolQueueDepth = promauto.NewGaugeVec( // nolint:gochecknoglobals // Why: cleaner to use everywhere
+	prometheus.GaugeOpts{
+		Name: "async_pool_queue_depth",
+		Help: "The number of tasks waiting in the queue of the pool",
+	},
+	[]string{"app", "pool"}, // Labels
+)
+
+// poolBusyWorkers registers the async_pool_busy_workers metric for
+// reporting the number of workers running a task.
+var poolBusyWorkers = promauto.NewGaugeVec( // nolint:gochecknoglobals // Why: cleaner to use everywhere
+	prometheus.GaugeOpts{
+		Name: "async_pool_busy_workers",
+		Help: "The number of workers of the pool running a task",
+	},
+	[]string{"app", "pool"}, // Labels
+)
+
+// poolWaitSeconds registers the async_pool_wait_seconds metric for
+// reporting the time tasks spent in the queue, in seconds.
+var poolWaitSeconds = promauto.NewHistogramVec( // nolint:gochecknoglobals // Why: cleaner to use everywhere
+	prometheus.HistogramOpts{
+		Name:    "async_pool_wait_seconds",
+		Help:    "The time between scheduling a task and a worker dequeuing it, in seconds",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+	},
+	[]string{"app", "pool"}, // Labels
+)
+
+// poolServiceSeconds registers the async_pool_service_seconds metric for
+// reporting the time workers spent running tasks, in seconds.
+var poolServiceSeconds = promauto.NewHistogramVec( // nolint:gochecknoglobals // Why: cleaner to use everywhere
+	prometheus.HistogramOpts{
+		Name:    "async_pool_service_seconds",
+		Help:    "The time it took a worker to run a task, in seconds",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+	},
+	[]string{"app", "pool"}, // Labels
+)
+
+// poolRejections registers the async_pool_rejections_total metric for
+// counting the tasks rejected by RejectWhenFull.
+var poolRejections = promauto.NewCounterVec( // nolint:gochecknoglobals // Why: cleaner to use everywhere
+	prometheus.CounterOpts{
+		Name: "async_pool_rejections_total",
+		Help: "The number of tasks rejected because the queue of the pool was full",
+	},
+	[]string{"app", "pool"}, // Labels
+)
+
+// poolPriorityQueueDepth registers the async_pool_priority_queue_depth
+// metric for reporting the number of tasks waiting for a worker in
+// prioritized pools, by priority.
+var poolPriorityQueueDepth = promauto.NewGaugeVec( // nolint:gochecknoglobals // Why: cleaner to use everywhere
+	prometheus.GaugeOpts{
+		Name: "async_pool_priority_queue_depth",
+		Help: "The number of tasks of a priority waiting in the queue of the pool",
+	},
+	[]string{"app", "pool", "priority"}, // Labels
+)
+
+// poolPriorityWaitSeconds registers the async_pool_priority_wait_seconds
+// metric for reporting the time tasks spent in the queue of prioritized
+// pools, by priority, in seconds.
+var poolPriorityWaitSeconds = promauto.NewHistogramVec( // nolint:gochecknoglobals // Why: cleaner to use everywhere
+	prometheus.HistogramOpts{
+		Name:    "async_pool_priority_wait_seconds",
+		Help:    "The time between scheduling a task of a priority and a worker dequeuing it, in seconds",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+	},
+	[]string{"app", "pool", "priority"}, // Labels
+)
+
+// poolMetrics holds the metrics of a single pool.
+type poolMetrics struct {
+	app         string
+	name        string
+	prioritized bool
+
+	queueDepth  prometheus.Gauge
+	busyWorkers prometheus.Gauge
+	wait        prometheus.Observer
+	service     prometheus.Observer
+	rejections  prometheus.Counter
+}
+
+// newPoolMetrics creates the metrics of the pool with the given name.
+// The metrics by priority are only reported by prioritized pools.
+func newPoolMetrics(name string, prioritized bool) *poolMetrics {
+	appName := app.Info().Name
+	return &poolMetrics{
+		app:         appName,
+		name:        name,
+		prioritized: prioritized,
+		queueDepth:  poolQueueDepth.WithLabelValues(appName, name),
+		busyWorkers: poolBusyWorkers.WithLabelValues(appName, name),
+		wait:        poolWaitSeconds.WithLabelValues(appName, name),
+		service:     poolServiceSeconds.WithLabelValues(appName, name),
+		rejections:  poolRejections.WithLabelValues(appName, name),
+	}
+}
+
+// queued reports a change of the number of tasks waiting.
+func (m *poolMetrics) queued(priority Priority, delta float64) {
+	m.queueDepth.Add(delta)
+	if m.prioritized {
+		poolPriorityQueueDepth.WithLabelValues(m.app, m.name, priority.String()).Add(delta)
+	}
+}
+
+// observe reports the wait and service time of a task that finished.
+func (m *poolMetrics) observe(priority Priority, d *events.Durations) {
+	m.wait.Observe(d.WaitSeconds)
+	m.service.Observe(d.ServiceSeconds)
+	if m.prioritized {
+		poolPriorityWaitSeconds.WithLabelValues(m.app, m.name, priority.String()).Observe(d.WaitSeconds)
+	}
+}
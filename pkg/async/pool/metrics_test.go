@@ -0,0 +1,103 @@
+package pool
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/poll"
+
+	"github.com/grevych/gobox/pkg/app"
+	"github.com/grevych/gobox/pkg/async"
+)
+
+// sampleCount returns the number of observations of a histogram.
+func sampleCount(t *testing.T, o prometheus.Observer) uint64 {
+	var m dto.Metric
+	assert.NilError(t, o.(prometheus.Metric).Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestPoolMetrics(t *testing.T) {
+	ctx := context.Background()
+	name := "test_pool_metrics"
+	appName := app.Info().Name
+
+	rejections := poolRejections.WithLabelValues(appName, name)
+	service := poolServiceSeconds.WithLabelValues(appName, name)
+	wait := poolWaitSeconds.WithLabelValues(appName, name)
+	rejected, served, waited := testutil.ToFloat64(rejections), sampleCount(t, service), sampleCount(t, wait)
+
+	p := New(ctx, Name(name), ConstantSize(1), BufferLength(1), RejectWhenFull)
+	defer p.Close()
+
+	release := make(chan struct{})
+	var once sync.Once
+	defer once.Do(func() { close(release) })
+	block := async.Func(func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+
+	// one running, one queued, one rejected
+	assert.NilError(t, p.Schedule(ctx, block))
+	busy := poolBusyWorkers.WithLabelValues(appName, name)
+	poll.WaitOn(t, func(poll.LogT) poll.Result {
+		if testutil.ToFloat64(busy) == 1 {
+			return poll.Success()
+		}
+		return poll.Continue("waiting for a busy worker")
+	}, poll.WithTimeout(time.Second))
+
+	assert.NilError(t, p.Schedule(ctx, block))
+	assert.Equal(t, testutil.ToFloat64(poolQueueDepth.WithLabelValues(appName, name)), 1.0)
+
+	//nolint:errcheck // Why: the runner reports the rejection
+	p.Schedule(ctx, async.Func(func(ctx context.Context) error { return ctx.Err() }))
+	assert.Equal(t, testutil.ToFloat64(rejections), rejected+1)
+
+	once.Do(func() { close(release) })
+	poll.WaitOn(t, func(poll.LogT) poll.Result {
+		if sampleCount(t, service) == served+2 {
+			return poll.Success()
+		}
+		return poll.Continue("waiting for the tasks to finish")
+	}, poll.WithTimeout(time.Second))
+
+	assert.Equal(t, sampleCount(t, wait), waited+2)
+	assert.Equal(t, testutil.ToFloat64(busy), 0.0)
+	assert.Equal(t, testutil.ToFloat64(poolQueueDepth.WithLabelValues(appName, name)), 0.0)
+}
+
+func TestPoolMetrics_Prioritized(t *testing.T) {
+	ctx := context.Background()
+	name := "test_pool_metrics_prioritized"
+	appName := app.Info().Name
+
+	wait := poolPriorityWaitSeconds.WithLabelValues(appName, name, PriorityLow.String())
+	waited := sampleCount(t, wait)
+
+	p := New(ctx, Name(name), ConstantSize(1), Prioritized(time.Minute))
+	defer p.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	assert.NilError(t, p.SchedulePriority(ctx, PriorityLow, async.Func(func(context.Context) error {
+		wg.Done()
+		return nil
+	})))
+	wg.Wait()
+
+	poll.WaitOn(t, func(poll.LogT) poll.Result {
+		if sampleCount(t, wait) == waited+1 {
+			return poll.Success()
+		}
+		return poll.Continue("waiting for the task to finish")
+	}, poll.WithTimeout(time.Second))
+	assert.Equal(t, testutil.ToFloat64(poolPriorityQueueDepth.WithLabelValues(appName, name, "2")), 0.0)
+}
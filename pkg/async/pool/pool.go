@@ -2,7 +2,12 @@
 
 // Description: Provides an async pool implementation
 
-// Package pool implements an async pool
+// Package pool implements an async pool.
+//
+// Executor is the supported way of using the pool. The Schedule based
+// API (New, Pool.Schedule, WithWait, WithTimeout and WithLogging) is
+// deprecated in favor of Executor or of
+// https://pkg.go.dev/github.com/sourcegraph/conc/pool, see the README.
 package pool
 
 import (
@@ -34,13 +39,6 @@ func (of OptionFunc) Apply(opts *Options) {
 type SizeFunc func() int
 
 // ConstantSize provides constant size for the pool.
-//
-// Deprecated: This library is being deprecated in favor of using
-// https://pkg.go.dev/github.com/sourcegraph/conc/pool instead. There is
-// no equivalent because calls to (*Pool).Go() will block if there are
-// no free workers. Control the size of the worker pool by calling
-// (*Pool).WithMaxGoroutines(). For more information, see the README:
-// https://github.com/grevych/gobox/tree/main/pkg/async/pool/README.md
 func ConstantSize(size int) OptionFunc {
 	return func(opts *Options) {
 		opts.Size = func() int {
@@ -70,6 +68,13 @@ func ResizeEvery(d time.Duration) OptionFunc {
 	}
 }
 
+// Name helps to set Name option
+func Name(name string) OptionFunc {
+	return func(opts *Options) {
+		opts.Name = name
+	}
+}
+
 // ScheduleBehavior defines the behavior of pool Schedule method
 type ScheduleBehavior func(context.Context, chan unit, async.Runner) error
 
@@ -111,6 +116,10 @@ type Options struct {
 	// Size allows to dynamically resolve number of workers that should spawned
 	Size SizeFunc
 
+	// Sizer adaptively sizes the pool from its queue length, task latency
+	// and error rate. It takes precedence over Size when set
+	Sizer Sizer
+
 	// ResizeEvery defined intervals when pool will be resized (shrank or grown)
 	ResizeEvery time.Duration
 
@@ -121,7 +130,16 @@ type Options struct {
 	// BufferLength defines size of buffered channel queue
 	BufferLength int
 
-	// Pool name for logging reasons
+	// Prioritized makes workers take the scheduled work by priority
+	// instead of in order, see SchedulePriority
+	Prioritized bool
+
+	// Aging is the time after which waiting work is treated as one
+	// priority higher, so that low priority work eventually runs. It is
+	// only used when Prioritized is set
+	Aging time.Duration
+
+	// Pool name for logging reasons, and the pool label of its metrics
 	Name string
 }
 
@@ -132,15 +150,18 @@ type Pool struct {
 	context context.Context
 	closed  chan struct{}
 	opts    *Options
-	queue   chan unit
+	queue   *backlog
+	stats   poolStats
+	metrics *poolMetrics
 	wg      *sync.WaitGroup
 }
 
 // New creates new instance of Pool and start goroutine that will spawn the workers
 // Call Close() to release pool resource
 //
-// Deprecated: This library is being deprecated in favor of using
-// https://pkg.go.dev/github.com/sourcegraph/conc/pool instead. Use
+// Deprecated: The Schedule based API of this package is deprecated in
+// favor of Executor or of
+// https://pkg.go.dev/github.com/sourcegraph/conc/pool. Use
 // (*Pool).New().WithContext() instead. Replace calls to Schedule with
 // (*Pool).Go(). For more information, see the README:
 // https://github.com/grevych/gobox/tree/main/pkg/async/pool/README.md
@@ -159,16 +180,24 @@ func New(ctx context.Context, options ...Option) *Pool {
 	}
 
 	ctx, cancel := orerr.CancelWithError(ctx)
+	metrics := newPoolMetrics(opts.Name, opts.Prioritized)
 	p := &Pool{
 		wg:      new(sync.WaitGroup),
-		queue:   make(chan unit, opts.BufferLength),
+		queue:   newBacklog(opts, metrics),
+		metrics: metrics,
 		opts:    opts,
 		cancel:  cancel,
 		context: ctx,
 		closed:  make(chan struct{}),
 	}
+	size := p.opts.Size()
+	if p.opts.Sizer != nil {
+		size = p.opts.Sizer.Initial()
+	}
+	reportResize(p.opts.Name, Stats{Size: size}, size)
+
 	// spawn initial workers synchronously
-	cancellations := p.spawnWorkers(ctx, p.opts.Size())
+	cancellations := p.spawnWorkers(ctx, size)
 	p.wg.Add(1)
 	go p.run(ctx, cancellations)
 	return p
@@ -188,56 +217,82 @@ func (p *Pool) spawnWorkers(ctx context.Context, n int) cancellations {
 
 func (p *Pool) run(ctx context.Context, cancellations cancellations) {
 	defer p.wg.Done()
-	var (
-		prevSize, delta int
-	)
+	last := time.Now()
 	for ctx.Err() == nil {
-		prevSize = len(cancellations)
-		delta = p.opts.Size() - prevSize
-		if delta < 0 {
-			// Cancel some workers
-			cancellations = cancellations.Shrink(-delta)
-		} else if delta > 0 {
-			// Spawn new workers
-			cancellations = append(cancellations, p.spawnWorkers(ctx, delta)...)
-		}
-		if delta != 0 {
-			log.Info(ctx, "async.pool resized",
-				log.F{
-					"pool":     p.opts.Name,
-					"size":     len(cancellations),
-					"previous": prevSize,
-				},
-			)
-		}
-
 		select {
 		case <-time.After(p.opts.ResizeEvery):
-			continue
 		case <-p.closed:
 			return
 		case <-ctx.Done():
 			return
 		}
+
+		stats := p.stats.collect(len(cancellations), p.queue.len(), time.Since(last))
+		last = time.Now()
+		cancellations = p.resize(ctx, cancellations, stats)
 	}
 }
 
+// resize grows or shrinks the pool to the size decided by the Sizer, or
+// returned by the Size function, from the given stats.
+func (p *Pool) resize(ctx context.Context, cancellations cancellations, stats Stats) cancellations {
+	size := p.opts.Size()
+	if p.opts.Sizer != nil {
+		size = p.opts.Sizer.Resize(stats)
+	}
+	reportResize(p.opts.Name, stats, size)
+
+	delta := size - stats.Size
+	if delta < 0 {
+		// Cancel some workers
+		cancellations = cancellations.Shrink(-delta)
+	} else if delta > 0 {
+		// Spawn new workers
+		cancellations = append(cancellations, p.spawnWorkers(ctx, delta)...)
+	}
+	if delta != 0 {
+		log.Info(ctx, "async.pool resized",
+			log.F{
+				"pool":         p.opts.Name,
+				"size":         len(cancellations),
+				"previous":     stats.Size,
+				"queue_length": stats.QueueLength,
+				"busy":         stats.Busy,
+				"completed":    stats.Completed,
+				"failed":       stats.Failed,
+				"error_rate":   stats.ErrorRate(),
+				"latency":      stats.Latency.String(),
+			},
+		)
+	}
+	return cancellations
+}
+
 func (p *Pool) worker(ctx context.Context) {
 	defer p.wg.Done()
-	var u unit
 	for {
-		select {
-		case u = <-p.queue:
-			//nolint:errcheck // Why: best effort
-			_ = u.Runner.Run(u.Context)
-		case <-p.closed:
-			return
-		case <-ctx.Done():
+		u, ok := p.queue.receive(ctx, p.closed)
+		if !ok {
 			return
 		}
+		p.process(u)
 	}
 }
 
+// process runs a unit, reporting its wait and service time.
+func (p *Pool) process(u unit) {
+	times := events.Times{Scheduled: u.Scheduled, Started: time.Now()}
+	p.stats.start()
+	p.metrics.busyWorkers.Inc()
+
+	err := u.Runner.Run(u.Context)
+
+	times.Finished = time.Now()
+	p.metrics.busyWorkers.Dec()
+	p.stats.finish(times.Finished.Sub(times.Started), err)
+	p.metrics.observe(u.Priority, times.Durations())
+}
+
 // Close blocks until all workers finshes current items and terminates
 func (p *Pool) Close() {
 	p.cancel(&orerr.ShutdownError{Err: context.Canceled})
@@ -252,19 +307,24 @@ func (p *Pool) Close() {
 // - When the given context is Done and item is not scheduled (Timeout, buffered queue full)
 // - When pool is in shutdown phase.
 //
-// Deprecated: This library is being deprecated in favor of using
-// https://pkg.go.dev/github.com/sourcegraph/conc/pool instead. Replace
+// Deprecated: The Schedule based API of this package is deprecated in
+// favor of Executor or of
+// https://pkg.go.dev/github.com/sourcegraph/conc/pool. Replace
 // calls to Schedule with (*Pool).Go(). For more information, see the
 // README:
 // https://github.com/grevych/gobox/tree/main/pkg/async/pool/README.md
 func (p *Pool) Schedule(ctx context.Context, r async.Runner) error {
+	return p.schedule(ctx, PriorityNormal, r)
+}
+
+func (p *Pool) schedule(ctx context.Context, priority Priority, r async.Runner) error {
 	// Check whether pool is alive
 	if p.context.Err() != nil {
 		ctxErr, cancel := orerr.CancelWithError(ctx)
 		cancel(p.context.Err())
 		return r.Run(ctxErr)
 	}
-	return p.opts.ScheduleBehavior(ctx, p.queue, r)
+	return p.queue.schedule(ctx, p.opts.ScheduleBehavior, unit{Runner: r, Priority: priority, Scheduled: time.Now()})
 }
 
 type cancellations []context.CancelFunc
@@ -286,8 +346,10 @@ func (c cancellations) Shrink(by int) cancellations {
 }
 
 type unit struct {
-	Context context.Context
-	Runner  async.Runner
+	Context   context.Context
+	Runner    async.Runner
+	Priority  Priority
+	Scheduled time.Time
 }
 
 type loggingScheduler struct {
@@ -298,8 +360,9 @@ type loggingScheduler struct {
 // Schedule task for processing in the pool with logging for each item
 // being scheduled and executed.
 //
-// Deprecated: This library is being deprecated in favor of using
-// https://pkg.go.dev/github.com/sourcegraph/conc/pool instead. There is
+// Deprecated: The Schedule based API of this package is deprecated in
+// favor of Executor or of
+// https://pkg.go.dev/github.com/sourcegraph/conc/pool. There is
 // no replacement for this function. Instead, log on each item when
 // calling (*Pool).Go(). For more information, see the README:
 // https://github.com/grevych/gobox/tree/main/pkg/async/pool/README.md
@@ -312,8 +375,9 @@ func (w *loggingScheduler) Schedule(ctx context.Context, r async.Runner) error {
 // WithLogging creates a scheduler which logs the errors returned from
 // the scheduling as well as executing phase.
 //
-// Deprecated: This library is being deprecated in favor of using
-// https://pkg.go.dev/github.com/sourcegraph/conc/pool instead. There is
+// Deprecated: The Schedule based API of this package is deprecated in
+// favor of Executor or of
+// https://pkg.go.dev/github.com/sourcegraph/conc/pool. There is
 // no replacement for this function. Instead, log on each item when
 // calling (*Pool).Go(). For more information, see the README:
 // https://github.com/grevych/gobox/tree/main/pkg/async/pool/README.md
@@ -0,0 +1,63 @@
+// Description: Provides priority scheduling for the async pool
+
+package pool
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/grevych/gobox/pkg/async"
+)
+
+// DefaultAging is the aging of prioritized pools that set none.
+const DefaultAging = 10 * time.Second
+
+// Priority is the priority of scheduled work. Lower values run first.
+//
+// Priorities are reported as a metric label, so a pool should only use
+// a handful of them.
+type Priority int
+
+// Contains the usual priorities.
+const (
+	// PriorityHigh is for latency sensitive work, like serving a request.
+	PriorityHigh Priority = iota
+
+	// PriorityNormal is the priority of work scheduled with Schedule.
+	PriorityNormal
+
+	// PriorityLow is for batch work.
+	PriorityLow
+)
+
+// String returns the priority as a number.
+func (p Priority) String() string {
+	return strconv.Itoa(int(p))
+}
+
+// Prioritized makes the workers of the pool take scheduled work by
+// priority, instead of in order. Work of the same priority still runs
+// in order.
+//
+// To keep low priority work from starving, work is treated as one
+// priority higher for every aging period it waited: with an aging of
+// 10s, PriorityLow work that waited 30s runs before PriorityHigh work
+// scheduled just now, and after it if it waited 10s. A non-positive
+// aging means DefaultAging.
+//
+//	p := pool.New(ctx, pool.Prioritized(5*time.Second))
+//	p.SchedulePriority(ctx, pool.PriorityHigh, interactive)
+//	p.SchedulePriority(ctx, pool.PriorityLow, batch)
+func Prioritized(aging time.Duration) OptionFunc {
+	return func(opts *Options) {
+		opts.Prioritized = true
+		opts.Aging = aging
+	}
+}
+
+// SchedulePriority schedules the runner like Schedule, with the given
+// priority. The priority is ignored unless the pool is Prioritized.
+func (p *Pool) SchedulePriority(ctx context.Context, priority Priority, r async.Runner) error {
+	return p.schedule(ctx, priority, r)
+}
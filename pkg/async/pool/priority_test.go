@@ -0,0 +1,108 @@
+package pool_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grevych/gobox/pkg/async"
+	"github.com/grevych/gobox/pkg/async/pool"
+	"github.com/grevych/gobox/pkg/orerr"
+	"gotest.tools/v3/assert"
+)
+
+// runInOrder blocks the only worker of p, schedules the given work and
+// returns the order it ran in once the worker is released.
+func runInOrder(t *testing.T, p *pool.Pool, schedule func(run func(name string) async.Runner)) []string {
+	ctx := context.Background()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	assert.NilError(t, p.SchedulePriority(ctx, pool.PriorityHigh, async.Func(func(context.Context) error {
+		close(started)
+		<-release
+		return nil
+	})))
+	<-started
+
+	var (
+		mu    sync.Mutex
+		order []string
+		wg    sync.WaitGroup
+	)
+	schedule(func(name string) async.Runner {
+		wg.Add(1)
+		return async.Func(func(context.Context) error {
+			defer wg.Done()
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+			return nil
+		})
+	})
+
+	close(release)
+	wg.Wait()
+	return order
+}
+
+func TestPrioritized(t *testing.T) {
+	ctx := context.Background()
+	p := pool.New(ctx, pool.ConstantSize(1), pool.Prioritized(time.Hour))
+	defer p.Close()
+
+	order := runInOrder(t, p, func(run func(name string) async.Runner) {
+		assert.NilError(t, p.SchedulePriority(ctx, pool.PriorityLow, run("low-1")))
+		assert.NilError(t, p.Schedule(ctx, run("normal-1")))
+		assert.NilError(t, p.SchedulePriority(ctx, pool.PriorityHigh, run("high-1")))
+		assert.NilError(t, p.SchedulePriority(ctx, pool.PriorityLow, run("low-2")))
+		assert.NilError(t, p.SchedulePriority(ctx, pool.PriorityHigh, run("high-2")))
+	})
+	assert.DeepEqual(t, order, []string{"high-1", "high-2", "normal-1", "low-1", "low-2"})
+}
+
+func TestPrioritized_Aging(t *testing.T) {
+	ctx := context.Background()
+	p := pool.New(ctx, pool.ConstantSize(1), pool.Prioritized(10*time.Millisecond))
+	defer p.Close()
+
+	order := runInOrder(t, p, func(run func(name string) async.Runner) {
+		assert.NilError(t, p.SchedulePriority(ctx, pool.PriorityLow, run("low")))
+		time.Sleep(30 * time.Millisecond)
+		assert.NilError(t, p.SchedulePriority(ctx, pool.PriorityHigh, run("high")))
+	})
+	assert.DeepEqual(t, order, []string{"low", "high"})
+}
+
+func TestPrioritized_RejectWhenFull(t *testing.T) {
+	ctx := context.Background()
+	e := pool.NewExecutor[int](ctx,
+		pool.ConstantSize(1), pool.BufferLength(1), pool.RejectWhenFull, pool.Prioritized(0),
+	)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	running, err := e.SubmitPriority(ctx, pool.PriorityLow, "running", func(context.Context) (int, error) {
+		close(started)
+		<-release
+		return 1, nil
+	})
+	assert.NilError(t, err)
+	<-started
+
+	queued, err := e.SubmitPriority(ctx, pool.PriorityHigh, "queued", func(context.Context) (int, error) {
+		return 2, nil
+	})
+	assert.NilError(t, err)
+
+	_, err = e.Submit(ctx, "rejected", func(context.Context) (int, error) { return 3, nil })
+	assert.Assert(t, errors.As(err, &orerr.LimitExceededError{}))
+
+	close(release)
+	values, err := async.AwaitAll(ctx, running, queued)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, values, []int{1, 2})
+
+	_, err = e.Close(ctx)
+	assert.NilError(t, err)
+}
@@ -19,8 +19,9 @@ func (sf SchedulerFunc) Schedule(ctx context.Context, r async.Runner) error {
 type Scheduler interface {
 	// Schedule task for processing in the pool
 	//
-	// Deprecated: This library is being deprecated in favor of using
-	// https://pkg.go.dev/github.com/sourcegraph/conc/pool instead.
+	// Deprecated: The Schedule based API of this package is deprecated in
+	// favor of Executor or of
+	// https://pkg.go.dev/github.com/sourcegraph/conc/pool.
 	// Replaces calls to Schedule with (*Pool).Go().  For more information,
 	// see the README:
 	// https://github.com/grevych/gobox/tree/main/pkg/async/pool/README.md
@@ -0,0 +1,351 @@
+// Description: Provides adaptive sizers for the async pool
+
+package pool
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/grevych/gobox/pkg/app"
+)
+
+// poolSize registers the async_pool_size metric for reporting the
+// number of workers of the pools.
+var poolSize = promauto.NewGaugeVec( // nolint:gochecknoglobals // Why: cleaner to use everywhere
+	prometheus.GaugeOpts{
+		Name: "async_pool_size",
+		Help: "The number of workers of the pool",
+	},
+	[]string{"app", "pool"}, // Labels
+)
+
+// poolResizes registers the async_pool_resizes_total metric for counting
+// the times the pools grew or shrank.
+var poolResizes = promauto.NewCounterVec( // nolint:gochecknoglobals // Why: cleaner to use everywhere
+	prometheus.CounterOpts{
+		Name: "async_pool_resizes_total",
+		Help: "The number of times the pool was resized",
+	},
+	[]string{"app", "pool", "direction"}, // Labels
+)
+
+// poolResizeQueueLength registers the async_pool_resize_queue_length
+// metric for reporting the queue length seen by the last resize decision.
+var poolResizeQueueLength = promauto.NewGaugeVec( // nolint:gochecknoglobals // Why: cleaner to use everywhere
+	prometheus.GaugeOpts{
+		Name: "async_pool_resize_queue_length",
+		Help: "The number of queued tasks seen by the last resize decision of the pool",
+	},
+	[]string{"app", "pool"}, // Labels
+)
+
+// poolResizeLatency registers the async_pool_resize_latency_seconds
+// metric for reporting the task latency seen by the last resize decision.
+var poolResizeLatency = promauto.NewGaugeVec( // nolint:gochecknoglobals // Why: cleaner to use everywhere
+	prometheus.GaugeOpts{
+		Name: "async_pool_resize_latency_seconds",
+		Help: "The average task latency seen by the last resize decision of the pool, in seconds",
+	},
+	[]string{"app", "pool"}, // Labels
+)
+
+// poolResizeErrorRate registers the async_pool_resize_error_rate metric
+// for reporting the error rate seen by the last resize decision.
+var poolResizeErrorRate = promauto.NewGaugeVec( // nolint:gochecknoglobals // Why: cleaner to use everywhere
+	prometheus.GaugeOpts{
+		Name: "async_pool_resize_error_rate",
+		Help: "The fraction of failed tasks seen by the last resize decision of the pool",
+	},
+	[]string{"app", "pool"}, // Labels
+)
+
+// Stats is what a pool observed since its previous resize decision.
+type Stats struct {
+	// Size is the current number of workers.
+	Size int
+
+	// QueueLength is the number of tasks waiting in the queue.
+	QueueLength int
+
+	// Busy is the number of workers running a task.
+	Busy int
+
+	// Completed is the number of tasks that finished.
+	Completed int
+
+	// Failed is the number of finished tasks that returned an error.
+	Failed int
+
+	// Latency is the average time it took to run the finished tasks,
+	// zero if none finished.
+	Latency time.Duration
+
+	// Interval is the time since the previous decision.
+	Interval time.Duration
+}
+
+// ErrorRate returns the fraction of finished tasks that failed.
+func (s Stats) ErrorRate() float64 {
+	if s.Completed == 0 {
+		return 0
+	}
+	return float64(s.Failed) / float64(s.Completed)
+}
+
+// Utilization returns the fraction of the time the workers spent
+// running the finished tasks. Tasks still running are not counted: see
+// Busy for them.
+func (s Stats) Utilization() float64 {
+	if s.Size == 0 || s.Interval <= 0 {
+		return 0
+	}
+	return float64(s.Latency) * float64(s.Completed) / (float64(s.Interval) * float64(s.Size))
+}
+
+// Sizer adaptively sizes a pool from the Stats it observed. The pool
+// calls Resize every ResizeEvery, from a single goroutine, so a Sizer
+// must not be shared between pools.
+type Sizer interface {
+	// Initial returns the number of workers to start with.
+	Initial() int
+
+	// Resize returns the new number of workers.
+	Resize(stats Stats) int
+}
+
+// Adaptive sizes the pool with the given Sizer instead of the Size
+// option. As the sizer only reacts every ResizeEvery, combine it with a
+// short interval:
+//
+//	p := pool.New(ctx, pool.Adaptive(pool.NewAIMD(2, 64)), pool.ResizeEvery(time.Second))
+func Adaptive(sizer Sizer) OptionFunc {
+	return func(opts *Options) {
+		opts.Sizer = sizer
+	}
+}
+
+// AIMD is a Sizer that grows the pool additively while tasks queue up,
+// and shrinks it multiplicatively when tasks fail or get slow.
+type AIMD struct {
+	// Min and Max bound the number of workers.
+	Min, Max int
+
+	// Increase is the number of workers added when tasks queue up, and
+	// removed when the workers are mostly idle.
+	Increase int
+
+	// Backoff is the factor applied to the size when tasks fail or get
+	// slow.
+	Backoff float64
+
+	// MaxErrorRate is the fraction of failed tasks above which the pool
+	// backs off.
+	MaxErrorRate float64
+
+	// MaxLatency is the average task latency above which the pool backs
+	// off. Zero disables it.
+	MaxLatency time.Duration
+}
+
+// NewAIMD creates an AIMD sizer bounded by min and max workers. It adds
+// one worker at a time, backs off by 25% and tolerates 10% of errors.
+func NewAIMD(min, max int) *AIMD {
+	return &AIMD{
+		Min:          min,
+		Max:          max,
+		Increase:     1,
+		Backoff:      0.75,
+		MaxErrorRate: 0.1,
+	}
+}
+
+// Initial implements Sizer, starting with Min workers.
+func (a *AIMD) Initial() int {
+	return clampSize(a.Min, a.Min, a.Max)
+}
+
+// Resize implements Sizer.
+func (a *AIMD) Resize(s Stats) int {
+	size := s.Size
+	switch {
+	case s.ErrorRate() > a.MaxErrorRate, a.MaxLatency > 0 && s.Latency > a.MaxLatency:
+		size = int(float64(size) * a.Backoff)
+	case s.QueueLength > 0:
+		size += a.Increase
+	case s.Size > 0 && float64(s.Busy)/float64(s.Size) < 0.5 && s.Utilization() < 0.5:
+		// Utilization misses tasks running for the whole interval, which
+		// keep the workers Busy
+		size -= a.Increase
+	}
+	return clampSize(size, a.Min, a.Max)
+}
+
+// Gradient is a Sizer adapted from the gradient concurrency limit of
+// Netflix's concurrency-limits. It compares the latency of recent tasks
+// to a long-term baseline: the pool shrinks as the latency rises above
+// the baseline, and grows by a headroom of the square root of its size
+// while tasks queue up and the latency holds.
+type Gradient struct {
+	// Min and Max bound the number of workers.
+	Min, Max int
+
+	// Tolerance is how many times the baseline the latency may reach
+	// before the pool shrinks.
+	Tolerance float64
+
+	// Smoothing is the fraction, in (0, 1], of each change applied to the
+	// size.
+	Smoothing float64
+
+	// Window is the number of decisions the baseline latency averages
+	// over.
+	Window int
+
+	// MaxErrorRate is the fraction of failed tasks above which the pool
+	// shrinks at its fastest rate.
+	MaxErrorRate float64
+
+	limit    float64
+	baseline float64
+}
+
+// NewGradient creates a Gradient sizer bounded by min and max workers,
+// tolerating latencies of up to 1.5 times the baseline and 10% of errors.
+func NewGradient(min, max int) *Gradient {
+	return &Gradient{
+		Min:          min,
+		Max:          max,
+		Tolerance:    1.5,
+		Smoothing:    0.2,
+		Window:       20,
+		MaxErrorRate: 0.1,
+	}
+}
+
+// Initial implements Sizer, starting with Min workers.
+func (g *Gradient) Initial() int {
+	return clampSize(g.Min, g.Min, g.Max)
+}
+
+// Resize implements Sizer.
+func (g *Gradient) Resize(s Stats) int {
+	if g.limit == 0 {
+		g.limit = float64(s.Size)
+	}
+	if s.Completed == 0 || s.Latency <= 0 {
+		// nothing to learn from
+		return clampSize(int(math.Round(g.limit)), g.Min, g.Max)
+	}
+
+	latency := float64(s.Latency)
+	if g.baseline == 0 {
+		g.baseline = latency
+	} else {
+		window := math.Max(float64(g.Window), 1)
+		g.baseline += (latency - g.baseline) / window
+	}
+	if g.baseline > 2*latency {
+		// the latency recovered from a long period of load, let the
+		// baseline catch up faster
+		g.baseline *= 0.95
+	}
+
+	gradient := math.Max(0.5, math.Min(1, g.Tolerance*g.baseline/latency))
+	if s.ErrorRate() > g.MaxErrorRate {
+		gradient = 0.5
+	}
+	limit := g.limit*gradient + math.Sqrt(g.limit)
+	if s.QueueLength == 0 && limit > g.limit {
+		// the workers keep up, more would not help
+		limit = g.limit
+	}
+
+	g.limit = g.limit*(1-g.Smoothing) + limit*g.Smoothing
+	g.limit = math.Max(float64(g.Min), math.Min(float64(g.Max), g.limit))
+	return clampSize(int(math.Round(g.limit)), g.Min, g.Max)
+}
+
+// clampSize bounds size to [min, max], with a minimum of one worker.
+func clampSize(size, min, max int) int {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	if size < min {
+		return min
+	}
+	if size > max {
+		return max
+	}
+	return size
+}
+
+// poolStats collects the Stats of a pool between resize decisions.
+type poolStats struct {
+	busy atomic.Int64
+
+	mu        sync.Mutex
+	completed int
+	failed    int
+	latency   time.Duration
+}
+
+// start records that a worker started running a task.
+func (s *poolStats) start() {
+	s.busy.Add(1)
+}
+
+// finish records that a worker finished running a task.
+func (s *poolStats) finish(d time.Duration, err error) {
+	s.busy.Add(-1)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.completed++
+	s.latency += d
+	if err != nil {
+		s.failed++
+	}
+}
+
+// collect returns the Stats since the previous call and resets them.
+func (s *poolStats) collect(size, queueLength int, interval time.Duration) Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := Stats{
+		Size:        size,
+		QueueLength: queueLength,
+		Busy:        int(s.busy.Load()),
+		Completed:   s.completed,
+		Failed:      s.failed,
+		Interval:    interval,
+	}
+	if s.completed > 0 {
+		stats.Latency = s.latency / time.Duration(s.completed)
+	}
+	s.completed, s.failed, s.latency = 0, 0, 0
+	return stats
+}
+
+// reportResize records a resize decision and its inputs in metrics.
+func reportResize(name string, stats Stats, size int) {
+	appName := app.Info().Name
+	poolSize.WithLabelValues(appName, name).Set(float64(size))
+	poolResizeQueueLength.WithLabelValues(appName, name).Set(float64(stats.QueueLength))
+	poolResizeLatency.WithLabelValues(appName, name).Set(stats.Latency.Seconds())
+	poolResizeErrorRate.WithLabelValues(appName, name).Set(stats.ErrorRate())
+	switch {
+	case size > stats.Size:
+		poolResizes.WithLabelValues(appName, name, "grow").Inc()
+	case size < stats.Size:
+		poolResizes.WithLabelValues(appName, name, "shrink").Inc()
+	}
+}
@@ -0,0 +1,165 @@
+package pool_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grevych/gobox/pkg/async"
+	"github.com/grevych/gobox/pkg/async/pool"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/poll"
+)
+
+func TestAIMD(t *testing.T) {
+	a := pool.NewAIMD(2, 10)
+	assert.Equal(t, a.Initial(), 2)
+
+	busy := pool.Stats{Size: 4, Completed: 40, Latency: 100 * time.Millisecond, Interval: time.Second}
+
+	// grows additively while tasks queue up
+	queued := busy
+	queued.QueueLength = 5
+	assert.Equal(t, a.Resize(queued), 5)
+
+	// holds while the workers are busy
+	assert.Equal(t, a.Resize(busy), 4)
+
+	// shrinks additively while the workers are mostly idle
+	idle := busy
+	idle.Completed = 4
+	assert.Equal(t, a.Resize(idle), 3)
+
+	// holds while the workers run tasks longer than the interval
+	running := idle
+	running.Busy, running.Completed, running.Latency = 4, 0, 0
+	assert.Equal(t, a.Resize(running), 4)
+
+	// backs off multiplicatively on errors, even with a queue
+	failing := queued
+	failing.Size = 8
+	failing.Failed = 10
+	assert.Equal(t, a.Resize(failing), 6)
+
+	// and on latency
+	a.MaxLatency = 50 * time.Millisecond
+	slow := queued
+	slow.Size = 8
+	assert.Equal(t, a.Resize(slow), 6)
+	a.MaxLatency = 0
+
+	// stays within bounds
+	queued.Size = 10
+	assert.Equal(t, a.Resize(queued), 10)
+	failing.Size = 2
+	assert.Equal(t, a.Resize(failing), 2)
+}
+
+func TestGradient(t *testing.T) {
+	g := pool.NewGradient(2, 50)
+	g.Smoothing = 1
+	assert.Equal(t, g.Initial(), 2)
+
+	stats := pool.Stats{Size: 16, QueueLength: 10, Completed: 100, Latency: 10 * time.Millisecond}
+
+	// grows by the square root of the size while the latency holds
+	size := g.Resize(stats)
+	assert.Equal(t, size, 20)
+
+	// does not grow when nothing is queued
+	stats.Size, stats.QueueLength = size, 0
+	assert.Equal(t, g.Resize(stats), 20)
+
+	// shrinks when the latency rises above the tolerance
+	stats.Latency = 30 * time.Millisecond
+	size = g.Resize(stats)
+	assert.Assert(t, size < 20, "size %d", size)
+
+	// shrinks at its fastest rate on errors
+	stats.Size, stats.Latency, stats.Failed = size, 10*time.Millisecond, 50
+	assert.Assert(t, g.Resize(stats) < size)
+
+	// keeps its size without completed tasks
+	stats.Completed, stats.Failed = 0, 0
+	assert.Equal(t, g.Resize(pool.Stats{Size: 7}), g.Resize(stats))
+}
+
+func TestAdaptivePool(t *testing.T) {
+	ctx := context.Background()
+	release := make(chan struct{})
+
+	p := pool.New(ctx, pool.Adaptive(pool.NewAIMD(1, 4)), pool.ResizeEvery(5*time.Millisecond))
+	defer p.Close()
+	assert.Assert(t, waitForWorkers(t, 1), "workers not detected")
+
+	for i := 0; i < 10; i++ {
+		//nolint:errcheck // Why: test
+		p.Schedule(ctx, async.Func(func(ctx context.Context) error {
+			<-release
+			return nil
+		}))
+	}
+	assert.Assert(t, waitForWorkers(t, 4), "workers not detected")
+
+	close(release)
+	assert.Assert(t, waitForWorkers(t, 1), "workers not detected")
+}
+
+// recordingSizer records the decisions of a Sizer.
+type recordingSizer struct {
+	pool.Sizer
+
+	mu    sync.Mutex
+	stats []pool.Stats
+	sizes []int
+}
+
+func (r *recordingSizer) Resize(stats pool.Stats) int {
+	size := r.Sizer.Resize(stats)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stats = append(r.stats, stats)
+	r.sizes = append(r.sizes, size)
+	return size
+}
+
+func TestAdaptivePoolLongRunningTasks(t *testing.T) {
+	ctx := context.Background()
+	release := make(chan struct{})
+	sizer := &recordingSizer{Sizer: pool.NewAIMD(1, 4)}
+
+	p := pool.New(ctx, pool.Adaptive(sizer), pool.ResizeEvery(5*time.Millisecond))
+	defer p.Close()
+	defer close(release)
+
+	for i := 0; i < 4; i++ {
+		//nolint:errcheck // Why: test
+		p.Schedule(ctx, async.Func(func(ctx context.Context) error {
+			<-release
+			return nil
+		}))
+	}
+
+	// the pool keeps its workers while they are all busy, even though no
+	// task completes
+	poll.WaitOn(t, func(poll.LogT) poll.Result {
+		sizer.mu.Lock()
+		defer sizer.mu.Unlock()
+		busy := 0
+		for i, stats := range sizer.stats {
+			if stats.Busy != 4 {
+				continue
+			}
+			if sizer.sizes[i] != 4 {
+				return poll.Error(fmt.Errorf("resized to %d with %+v", sizer.sizes[i], stats))
+			}
+			busy++
+		}
+		if busy < 10 {
+			return poll.Continue("waiting for resize decisions")
+		}
+		return poll.Success()
+	}, poll.WithTimeout(5*time.Second))
+}
@@ -14,8 +14,9 @@ import (
 // WithTimeout creates enqueuer that cancel enqueueing after given
 // timeout
 //
-// Deprecated: This library is being deprecated in favor of using
-// https://pkg.go.dev/github.com/sourcegraph/conc/pool instead. There is
+// Deprecated: The Schedule based API of this package is deprecated in
+// favor of Executor or of
+// https://pkg.go.dev/github.com/sourcegraph/conc/pool. There is
 // no equivalent to this function in the new library. For more
 // information, see the README:
 // https://github.com/grevych/gobox/tree/main/pkg/async/pool/README.md
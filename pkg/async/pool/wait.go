@@ -31,8 +31,9 @@ func (w *Wait) Schedule(ctx context.Context, r async.Runner) error {
 // that blocks until all scheduled tasks are processed or have failed to
 // enqueue.
 //
-// Deprecated: This library is being deprecated in favor of using
-// https://pkg.go.dev/github.com/sourcegraph/conc/pool instead. Use
+// Deprecated: The Schedule based API of this package is deprecated in
+// favor of Executor or of
+// https://pkg.go.dev/github.com/sourcegraph/conc/pool. Use
 // (*Pool).Wait() instead. For more information, see the README:
 // https://github.com/grevych/gobox/tree/main/pkg/async/pool/README.md
 func WithWait(s Scheduler) (scheduler Scheduler, wait func()) {
@@ -0,0 +1,250 @@
+// Description: Provides a registry of the tasks started by a TaskGroup
+
+package async
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxFinishedTasks is the number of finished tasks a TaskGroup keeps
+// around for its Snapshot.
+const maxFinishedTasks = 100
+
+// maxTaskErrors is the number of failures a TaskGroup keeps around for
+// WaitContext, so that groups never waited on, like Default, do not
+// accumulate them.
+const maxTaskErrors = 100
+
+// TaskState is the state of a task started by a TaskGroup.
+type TaskState string
+
+// Contains the task states.
+const (
+	// TaskRunning is the state of a task whose Runner is executing.
+	TaskRunning TaskState = "running"
+
+	// TaskBackoff is the state of a loop waiting to be restarted by its
+	// RestartPolicy.
+	TaskBackoff TaskState = "backoff"
+
+	// TaskDone is the state of a task that exited without an error.
+	TaskDone TaskState = "done"
+
+	// TaskFailed is the state of a task that exited with an error.
+	TaskFailed TaskState = "failed"
+)
+
+// TaskInfo describes a task started by a TaskGroup.
+type TaskInfo struct {
+	// ID identifies the task within its TaskGroup.
+	ID int64 `json:"id"`
+
+	// Name is the name of the task, see Named. It defaults to the name
+	// of the TaskGroup.
+	Name string `json:"name"`
+
+	// Kind is either "run" or "loop".
+	Kind string `json:"kind"`
+
+	// State is the current state of the task.
+	State TaskState `json:"state"`
+
+	// Started is when the task was started.
+	Started time.Time `json:"started_at"`
+
+	// Finished is when the task exited, nil while it is alive.
+	Finished *time.Time `json:"finished_at,omitempty"`
+
+	// Iterations is the number of times the Runner was called.
+	Iterations int64 `json:"iterations"`
+
+	// LastError is the last error returned by the Runner.
+	LastError string `json:"last_error,omitempty"`
+
+	// LastErrorAt is when LastError happened.
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// Named gives a runner a name, which is used to identify its task in
+// TaskGroup.Snapshot.
+//
+//	async.Loop(ctx, async.Named("orders-consumer", consumer))
+func Named(name string, r Runner) Runner {
+	return &namedRunner{name: name, Runner: r}
+}
+
+// namedRunner is the Runner returned by Named.
+type namedRunner struct {
+	Runner
+	name string
+}
+
+// Name returns the name of the runner.
+func (n *namedRunner) Name() string {
+	return n.name
+}
+
+// Close closes the inner runner.
+func (n *namedRunner) Close(ctx context.Context) error {
+	return RunClose(ctx, n.Runner)
+}
+
+// taskName returns the name of the task for r.
+func (t *TaskGroup) taskName(r Runner) string {
+	if n, ok := r.(interface{ Name() string }); ok {
+		return n.Name()
+	}
+	return t.Name
+}
+
+// taskRegistry tracks the running and recently finished tasks of a
+// TaskGroup. The zero value is ready to use.
+type taskRegistry struct {
+	mu       sync.Mutex
+	nextID   int64
+	running  map[int64]*TaskInfo
+	finished []TaskInfo
+
+	// errs holds the latest failures not yet reported by WaitContext.
+	errs []error
+}
+
+// start registers a new running task.
+func (reg *taskRegistry) start(name, kind string) *TaskInfo {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if reg.running == nil {
+		reg.running = map[int64]*TaskInfo{}
+	}
+
+	reg.nextID++
+	task := &TaskInfo{
+		ID:      reg.nextID,
+		Name:    name,
+		Kind:    kind,
+		State:   TaskRunning,
+		Started: time.Now(),
+	}
+	reg.running[task.ID] = task
+	return task
+}
+
+// iteration records a new call to the Runner of task.
+func (reg *taskRegistry) iteration(task *TaskInfo) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	task.Iterations++
+	task.State = TaskRunning
+}
+
+// failed records an error returned by the Runner of task.
+func (reg *taskRegistry) failed(task *TaskInfo, err error) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.setError(task, err)
+}
+
+// backoff marks task as waiting to be restarted.
+func (reg *taskRegistry) backoff(task *TaskInfo) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	task.State = TaskBackoff
+}
+
+// finish marks task as exited with the provided error.
+func (reg *taskRegistry) finish(task *TaskInfo, err error) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	now := time.Now()
+	task.Finished = &now
+	task.State = TaskDone
+	if err != nil {
+		task.State = TaskFailed
+		reg.setError(task, err)
+		reg.errs = append(reg.errs, &TaskError{Task: task.Name, Err: err})
+		if len(reg.errs) > maxTaskErrors {
+			reg.errs = reg.errs[len(reg.errs)-maxTaskErrors:]
+		}
+	}
+
+	delete(reg.running, task.ID)
+	reg.finished = append(reg.finished, *task)
+	if len(reg.finished) > maxFinishedTasks {
+		reg.finished = reg.finished[len(reg.finished)-maxFinishedTasks:]
+	}
+}
+
+// setError records err as the last error of task. It must be called
+// with the lock held.
+func (reg *taskRegistry) setError(task *TaskInfo, err error) {
+	now := time.Now()
+	task.LastError = err.Error()
+	task.LastErrorAt = &now
+}
+
+// drainErrors returns and forgets the failures recorded so far.
+func (reg *taskRegistry) drainErrors() []error {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	errs := reg.errs
+	reg.errs = nil
+	return errs
+}
+
+// snapshot returns a copy of the tasks sorted by ID.
+func (reg *taskRegistry) snapshot() []TaskInfo {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	tasks := make([]TaskInfo, 0, len(reg.running)+len(reg.finished))
+	tasks = append(tasks, reg.finished...)
+	for _, task := range reg.running {
+		tasks = append(tasks, *task)
+	}
+
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].ID < tasks[j].ID
+	})
+	return tasks
+}
+
+// Snapshot returns the state of the tasks started by the TaskGroup: all
+// the tasks that are still alive and the most recently finished ones.
+func (t *TaskGroup) Snapshot() []TaskInfo {
+	return t.tasks.snapshot()
+}
+
+// DebugHandler returns an http.Handler that renders the Snapshot of the
+// provided task groups as JSON, keyed by the TaskGroup name. When no
+// groups are provided, it renders the Default TaskGroup.
+//
+// Like pprof, it is meant to be mounted on a debug endpoint:
+//
+//	mux.Handle("/debug/async", async.DebugHandler(async.Default, consumers))
+func DebugHandler(groups ...*TaskGroup) http.Handler {
+	if len(groups) == 0 {
+		groups = []*TaskGroup{Default}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		snapshot := map[string][]TaskInfo{}
+		for _, g := range groups {
+			snapshot[g.Name] = append(snapshot[g.Name], g.Snapshot()...)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(snapshot); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
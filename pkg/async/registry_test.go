@@ -0,0 +1,90 @@
+package async_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grevych/gobox/pkg/async"
+	"gotest.tools/v3/assert"
+)
+
+func TestTaskGroup_Snapshot(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tg := async.NewTaskGroup("test")
+	tg.Run(ctx, async.Named("failing", async.Func(func(ctx context.Context) error {
+		return errors.New("some error")
+	})))
+
+	iterations := make(chan struct{})
+	tg.Loop(ctx, async.Named("consumer", async.Func(func(ctx context.Context) error {
+		select {
+		case iterations <- struct{}{}:
+		case <-ctx.Done():
+		}
+		return nil
+	})))
+	<-iterations
+	<-iterations
+
+	var consumer async.TaskInfo
+	for _, task := range tg.Snapshot() {
+		if task.Name == "consumer" {
+			consumer = task
+		}
+	}
+	assert.Equal(t, consumer.Kind, "loop")
+	assert.Equal(t, consumer.State, async.TaskRunning)
+	assert.Assert(t, consumer.Iterations >= 2)
+	assert.Assert(t, consumer.Finished == nil)
+
+	cancel()
+	tg.Wait()
+
+	snapshot := tg.Snapshot()
+	assert.Equal(t, len(snapshot), 2)
+	assert.Equal(t, snapshot[0].Name, "failing")
+	assert.Equal(t, snapshot[0].State, async.TaskFailed)
+	assert.Equal(t, snapshot[0].Iterations, int64(1))
+	assert.Equal(t, snapshot[0].LastError, "some error")
+	assert.Equal(t, snapshot[1].Name, "consumer")
+	assert.Equal(t, snapshot[1].State, async.TaskDone)
+	assert.Assert(t, snapshot[1].Finished != nil)
+}
+
+func TestDebugHandler(t *testing.T) {
+	tg := async.NewTaskGroup("test")
+	tg.Run(context.Background(), async.Func(func(ctx context.Context) error {
+		return nil
+	}))
+	tg.Wait()
+
+	rec := httptest.NewRecorder()
+	async.DebugHandler(tg).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/async", nil))
+	assert.Equal(t, rec.Header().Get("Content-Type"), "application/json")
+
+	var got map[string][]async.TaskInfo
+	assert.NilError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, len(got["test"]), 1)
+	assert.Equal(t, got["test"][0].Name, "test")
+	assert.Equal(t, got["test"][0].State, async.TaskDone)
+}
+
+func TestRun_FailuresAreBounded(t *testing.T) {
+	ctx := context.Background()
+	for i := 0; i < 250; i++ {
+		async.Run(ctx, async.Func(func(ctx context.Context) error {
+			return errors.New("some error")
+		}))
+	}
+
+	// nothing waits on the Default group, its failures must not pile up
+	async.Default.Wait()
+	err := async.Default.WaitContext(ctx)
+	errs := err.(interface{ Unwrap() []error }).Unwrap() //nolint:errorlint // Why: errors.Join
+	assert.Equal(t, len(errs), 100)
+}
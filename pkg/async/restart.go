@@ -0,0 +1,133 @@
+// Description: Provides restart policies for async loops
+
+package async
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// DefaultRestartPolicy is a reasonable restart policy for long running
+// background consumers: exponential backoff starting at one second and
+// capped at one minute, at most 10 restarts per 10 minutes and a reset
+// after five healthy minutes.
+//
+//nolint:gochecknoglobals // Why: shared defaults
+var DefaultRestartPolicy = RestartPolicy{
+	InitialBackoff: time.Second,
+	MaxBackoff:     time.Minute,
+	Multiplier:     2,
+	Jitter:         0.2,
+	MaxRestarts:    10,
+	Window:         10 * time.Minute,
+	ResetAfter:     5 * time.Minute,
+}
+
+// RestartPolicy controls how TaskGroup.LoopWithRestart reacts when its
+// Runner returns an error.
+//
+// Where Loop exits on the first error, LoopWithRestart sleeps for an
+// exponentially growing (and jittered) backoff and runs the Runner again
+// until the policy gives up.
+type RestartPolicy struct {
+	// InitialBackoff is the delay before the first restart.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the delay between restarts, jitter included. Zero
+	// means no cap.
+	MaxBackoff time.Duration
+
+	// Multiplier grows the delay after each consecutive failure. Values
+	// below 1 are treated as 1 (constant backoff).
+	Multiplier float64
+
+	// Jitter randomizes each delay by up to the given fraction of it in
+	// either direction. It is clamped to [0, 1].
+	Jitter float64
+
+	// MaxRestarts is the number of restarts allowed within Window
+	// before the loop gives up. Zero means unlimited restarts.
+	MaxRestarts int
+
+	// Window is the period over which MaxRestarts is counted. Zero
+	// counts every restart since the last reset.
+	Window time.Duration
+
+	// ResetAfter is how long the Runner needs to stay healthy (no errors)
+	// for the backoff and the restart count to be reset. Zero disables
+	// the reset.
+	ResetAfter time.Duration
+}
+
+// restarter tracks the restart state of a single loop.
+type restarter struct {
+	policy RestartPolicy
+
+	// attempt is the number of consecutive restarts since the last reset.
+	attempt int
+
+	// restarts holds the times of the restarts within the window.
+	restarts []time.Time
+
+	// resumed is when the Runner was last started again after a backoff.
+	resumed time.Time
+
+	// random returns a number in [0, 1), it is replaced in tests.
+	random func() float64
+}
+
+// newRestarter creates a restarter for the given policy.
+func newRestarter(p RestartPolicy) *restarter {
+	return &restarter{policy: p, random: rand.Float64} //nolint:gosec // Why: jitter does not need crypto rand
+}
+
+// next records a failure that happened at now and returns the delay
+// before the next restart. It returns false if the policy gives up.
+func (r *restarter) next(now time.Time) (time.Duration, bool) {
+	p := r.policy
+
+	if p.ResetAfter > 0 && !r.resumed.IsZero() && now.Sub(r.resumed) >= p.ResetAfter {
+		r.attempt = 0
+		r.restarts = r.restarts[:0]
+	}
+
+	if p.Window > 0 {
+		cutoff := now.Add(-p.Window)
+		kept := r.restarts[:0]
+		for _, t := range r.restarts {
+			if t.After(cutoff) {
+				kept = append(kept, t)
+			}
+		}
+		r.restarts = kept
+	}
+
+	if p.MaxRestarts > 0 && len(r.restarts) >= p.MaxRestarts {
+		return 0, false
+	}
+
+	delay := r.backoff()
+	r.attempt++
+	r.restarts = append(r.restarts, now)
+	r.resumed = now.Add(delay)
+	return delay, true
+}
+
+// backoff computes the jittered delay for the current attempt.
+func (r *restarter) backoff() time.Duration {
+	p := r.policy
+
+	multiplier := math.Max(p.Multiplier, 1)
+	// leave room for the jitter so the result never overflows
+	limit := float64(math.MaxInt64 / 4)
+	if p.MaxBackoff > 0 {
+		limit = float64(p.MaxBackoff)
+	}
+	delay := math.Min(float64(p.InitialBackoff)*math.Pow(multiplier, float64(r.attempt)), limit)
+
+	jitter := math.Min(math.Max(p.Jitter, 0), 1)
+	delay += delay * jitter * (2*r.random() - 1)
+
+	return time.Duration(math.Min(delay, limit))
+}
@@ -0,0 +1,122 @@
+package async
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRestarter(t *testing.T) {
+	// step is a failure at the given time since the start, and the
+	// expected outcome of the restarter
+	type step struct {
+		at    time.Duration
+		delay time.Duration
+		ok    bool
+	}
+
+	tests := []struct {
+		name   string
+		policy RestartPolicy
+		random float64
+		steps  []step
+	}{
+		{
+			name:   "exponential backoff",
+			policy: RestartPolicy{InitialBackoff: time.Second, MaxBackoff: 4 * time.Second, Multiplier: 2},
+			random: 0.5,
+			steps: []step{
+				{at: 0, delay: time.Second, ok: true},
+				{at: 2 * time.Second, delay: 2 * time.Second, ok: true},
+				{at: 5 * time.Second, delay: 4 * time.Second, ok: true},
+				{at: 10 * time.Second, delay: 4 * time.Second, ok: true},
+			},
+		},
+		{
+			name:   "reset after healthy run",
+			policy: RestartPolicy{InitialBackoff: time.Second, Multiplier: 2, ResetAfter: 10 * time.Second},
+			random: 0.5,
+			steps: []step{
+				{at: 0, delay: time.Second, ok: true},
+				// resumed at 1s, healthy for 1s
+				{at: 2 * time.Second, delay: 2 * time.Second, ok: true},
+				// resumed at 4s, healthy for 9s
+				{at: 13 * time.Second, delay: 4 * time.Second, ok: true},
+				// resumed at 17s, healthy for 10s
+				{at: 27 * time.Second, delay: time.Second, ok: true},
+			},
+		},
+		{
+			name:   "reset clears the restart count",
+			policy: RestartPolicy{InitialBackoff: time.Second, MaxRestarts: 2, ResetAfter: 10 * time.Second},
+			random: 0.5,
+			steps: []step{
+				{at: 0, delay: time.Second, ok: true},
+				{at: 2 * time.Second, delay: time.Second, ok: true},
+				{at: 13 * time.Second, delay: time.Second, ok: true},
+				{at: 15 * time.Second, delay: time.Second, ok: true},
+				{at: 17 * time.Second, ok: false},
+			},
+		},
+		{
+			name:   "restart window",
+			policy: RestartPolicy{InitialBackoff: time.Second, MaxRestarts: 2, Window: time.Minute},
+			random: 0.5,
+			steps: []step{
+				{at: 0, delay: time.Second, ok: true},
+				{at: 10 * time.Second, delay: time.Second, ok: true},
+				{at: 20 * time.Second, ok: false},
+				// the restart at 0 left the window
+				{at: 65 * time.Second, delay: time.Second, ok: true},
+				{at: 66 * time.Second, ok: false},
+			},
+		},
+		{
+			name:   "max restarts without window",
+			policy: RestartPolicy{InitialBackoff: time.Second, MaxRestarts: 1},
+			random: 0.5,
+			steps: []step{
+				{at: 0, delay: time.Second, ok: true},
+				{at: time.Hour, ok: false},
+			},
+		},
+		{
+			name:   "jitter lower bound",
+			policy: RestartPolicy{InitialBackoff: 10 * time.Second, Jitter: 0.2},
+			random: 0,
+			steps:  []step{{at: 0, delay: 8 * time.Second, ok: true}},
+		},
+		{
+			name:   "jitter upper bound",
+			policy: RestartPolicy{InitialBackoff: 10 * time.Second, Jitter: 0.2},
+			random: 1,
+			steps:  []step{{at: 0, delay: 12 * time.Second, ok: true}},
+		},
+		{
+			name:   "jitter capped by max backoff",
+			policy: RestartPolicy{InitialBackoff: 10 * time.Second, MaxBackoff: 11 * time.Second, Jitter: 0.2},
+			random: 1,
+			steps:  []step{{at: 0, delay: 11 * time.Second, ok: true}},
+		},
+		{
+			name:   "jitter clamped to 1",
+			policy: RestartPolicy{InitialBackoff: 10 * time.Second, Jitter: 5},
+			random: 0,
+			steps:  []step{{at: 0, delay: 0, ok: true}},
+		},
+	}
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRestarter(tt.policy)
+			r.random = func() float64 { return tt.random }
+			for _, s := range tt.steps {
+				delay, ok := r.next(start.Add(s.at))
+				assert.Equal(t, ok, s.ok, "failure at %v", s.at)
+				assert.Equal(t, delay, s.delay, "failure at %v", s.at)
+			}
+		})
+	}
+}
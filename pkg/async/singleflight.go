@@ -0,0 +1,147 @@
+// Description: Provides request coalescing with context support
+
+package async
+
+import (
+	"context"
+	"sync"
+
+	"github.com/grevych/gobox/pkg/log"
+	"github.com/grevych/gobox/pkg/trace"
+)
+
+// SingleFlight coalesces concurrent calls for the same key into a single
+// call, for example to avoid hundreds of goroutines loading the same
+// cache entry at once.
+//
+// The shared call runs under its own span, a child of the span of the
+// caller that started it. Every other caller waits under a span linked
+// (see trace.WithLink) to the span of the shared call.
+//
+// A caller can abandon the wait by canceling its context, without
+// canceling the shared call for the other callers. The shared call is
+// only canceled once every caller has abandoned it.
+//
+//	var loads = async.NewSingleFlight[string, *Account]("account.load")
+//
+//	account, shared, err := loads.Do(ctx, id, func(ctx context.Context) (*Account, error) {
+//	    return store.Load(ctx, id)
+//	})
+type SingleFlight[K comparable, V any] struct {
+	name string
+
+	mu    sync.Mutex
+	calls map[K]*flight[V]
+}
+
+// flight is a call in progress or completed.
+type flight[V any] struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	headers map[string][]string
+	waiters int
+
+	value V
+	err   error
+}
+
+// NewSingleFlight creates a new SingleFlight. The name is used for the
+// spans of the calls.
+func NewSingleFlight[K comparable, V any](name string) *SingleFlight[K, V] {
+	return &SingleFlight[K, V]{name: name, calls: map[K]*flight[V]{}}
+}
+
+// Do calls fn for key, unless a call for key is already in progress, in
+// which case it waits for that call and returns its result. shared
+// reports whether the result comes from a call started by another
+// caller.
+//
+// fn is called with a context that keeps the values of ctx, but is only
+// canceled when every caller waiting for it is gone. A panic in fn is
+// recovered and returned as a PanicError.
+func (g *SingleFlight[K, V]) Do(ctx context.Context, key K, fn func(ctx context.Context) (V, error)) (v V, shared bool,
+	err error) {
+	g.mu.Lock()
+	f, shared := g.calls[key]
+	if shared {
+		f.waiters++
+		g.mu.Unlock()
+
+		opts := []trace.SpanStartOption{trace.WithLink(f.headers)}
+		ctx = trace.StartSpanWithOptions(ctx, g.name, opts, log.F{"async.singleflight.shared": true})
+		defer trace.End(ctx)
+	} else {
+		f = g.start(ctx, key, fn)
+		g.mu.Unlock()
+	}
+
+	select {
+	case <-f.done:
+		return f.value, shared, f.err
+	case <-ctx.Done():
+		g.abandon(key, f)
+		var zero V
+		return zero, shared, ctx.Err()
+	}
+}
+
+// Forget makes the next call for key start a new call, even if a call
+// for key is in progress.
+func (g *SingleFlight[K, V]) Forget(key K) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.calls, key)
+}
+
+// start starts a call for key. It must be called with the lock held.
+func (g *SingleFlight[K, V]) start(ctx context.Context, key K, fn func(ctx context.Context) (V, error)) *flight[V] {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	ctx = trace.StartSpan(ctx, g.name)
+
+	f := &flight[V]{
+		done:    make(chan struct{}),
+		cancel:  cancel,
+		headers: trace.ToHeaders(ctx),
+		waiters: 1,
+	}
+	g.calls[key] = f
+
+	go func() {
+		defer close(f.done)
+		defer cancel()
+		defer trace.End(ctx)
+
+		f.value, f.err = g.run(ctx, fn)
+		//nolint:errcheck // Why: only recording the error on the span
+		_ = trace.Error(ctx, f.err)
+
+		g.mu.Lock()
+		if g.calls[key] == f {
+			delete(g.calls, key)
+		}
+		g.mu.Unlock()
+	}()
+	return f
+}
+
+// run calls fn, converting panics into errors.
+func (g *SingleFlight[K, V]) run(ctx context.Context, fn func(ctx context.Context) (V, error)) (v V, err error) {
+	defer RecoverPanic(ctx, "singleflight", &err)
+	return fn(ctx)
+}
+
+// abandon removes a caller from a call, canceling the call when nobody
+// waits for it anymore.
+func (g *SingleFlight[K, V]) abandon(key K, f *flight[V]) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	f.waiters--
+	if f.waiters > 0 {
+		return
+	}
+	f.cancel()
+	if g.calls[key] == f {
+		delete(g.calls, key)
+	}
+}
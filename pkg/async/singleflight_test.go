@@ -0,0 +1,172 @@
+package async_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grevych/gobox/pkg/async"
+	"github.com/grevych/gobox/pkg/trace"
+	"github.com/grevych/gobox/pkg/trace/tracetest"
+	"gotest.tools/v3/assert"
+)
+
+// blockingLoader returns a loader that counts its calls and returns
+// value once release is closed.
+func blockingLoader(calls *atomic.Int32, release <-chan struct{}, value string) func(context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		calls.Add(1)
+		select {
+		case <-release:
+			return value, nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+func TestSingleFlight_Coalesces(t *testing.T) {
+	g := async.NewSingleFlight[string, string]("test")
+	release := make(chan struct{})
+	var calls, shared atomic.Int32
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, isShared, err := g.Do(context.Background(), "key", blockingLoader(&calls, release, "value"))
+			assert.Check(t, err)
+			assert.Check(t, v == "value")
+			if isShared {
+				shared.Add(1)
+			}
+		}()
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, calls.Load(), int32(1))
+	assert.Equal(t, shared.Load(), int32(9))
+}
+
+func TestSingleFlight_AbandonDoesNotCancelOthers(t *testing.T) {
+	g := async.NewSingleFlight[string, string]("test")
+	release := make(chan struct{})
+	var calls atomic.Int32
+
+	// the caller that starts the call gives up
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		_, _, err := g.Do(ctx, "key", blockingLoader(&calls, release, "value"))
+		errc <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	resc := make(chan string, 1)
+	go func() {
+		v, shared, err := g.Do(context.Background(), "key", blockingLoader(&calls, release, "other"))
+		assert.Check(t, err)
+		assert.Check(t, shared)
+		resc <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	cancel()
+	assert.Assert(t, errors.Is(<-errc, context.Canceled))
+
+	close(release)
+	assert.Equal(t, <-resc, "value")
+	assert.Equal(t, calls.Load(), int32(1))
+}
+
+func TestSingleFlight_AllAbandonCancelsCall(t *testing.T) {
+	g := async.NewSingleFlight[string, string]("test")
+	canceled := make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-time.After(10 * time.Millisecond)
+		cancel()
+	}()
+
+	_, _, err := g.Do(ctx, "key", func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		close(canceled)
+		return "", ctx.Err()
+	})
+	assert.Assert(t, errors.Is(err, context.Canceled))
+	<-canceled
+
+	// a new call is started afterwards
+	v, shared, err := g.Do(context.Background(), "key", func(context.Context) (string, error) {
+		return "fresh", nil
+	})
+	assert.NilError(t, err)
+	assert.Assert(t, !shared)
+	assert.Equal(t, v, "fresh")
+}
+
+func TestSingleFlight_Panic(t *testing.T) {
+	g := async.NewSingleFlight[string, string]("test")
+	_, _, err := g.Do(context.Background(), "key", func(context.Context) (string, error) {
+		panic("oops")
+	})
+
+	var panicErr *async.PanicError
+	assert.Assert(t, errors.As(err, &panicErr))
+}
+
+func TestSingleFlight_LinksWaiters(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	defer recorder.Close()
+
+	g := async.NewSingleFlight[string, string]("load")
+	release := make(chan struct{})
+	var calls atomic.Int32
+
+	ctx := trace.StartSpan(context.Background(), "leader")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _, err := g.Do(ctx, "key", blockingLoader(&calls, release, "value"))
+		assert.Check(t, err)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	waiter := trace.StartSpan(context.Background(), "waiter")
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+	}()
+	_, shared, err := g.Do(waiter, "key", blockingLoader(&calls, release, "value"))
+	assert.NilError(t, err)
+	assert.Assert(t, shared)
+	<-done
+	trace.End(waiter)
+	trace.End(ctx)
+
+	var work, wait map[string]interface{}
+	for _, span := range recorder.Ended() {
+		if span["name"] != "load" {
+			continue
+		}
+		if _, ok := span["links"]; ok {
+			wait = span
+		} else {
+			work = span
+		}
+	}
+	assert.Assert(t, work != nil)
+	assert.Assert(t, wait != nil)
+
+	links := wait["links"].([]map[string]interface{})
+	assert.Equal(t, links[0]["spanContext.spanID"], work["spanContext.spanID"])
+	assert.Equal(t, wait["attributes.async.singleflight.shared"], true)
+}
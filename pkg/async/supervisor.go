@@ -0,0 +1,388 @@
+// Description: Provides an Erlang-style supervisor for runners
+
+package async
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grevych/gobox/pkg/events"
+	"github.com/grevych/gobox/pkg/log"
+	"github.com/grevych/gobox/pkg/orerr"
+	"github.com/grevych/gobox/pkg/trace"
+)
+
+// Strategy defines which children a Supervisor restarts when one of
+// them fails.
+type Strategy int
+
+const (
+	// OneForOne only restarts the child that failed.
+	OneForOne Strategy = iota
+
+	// OneForAll stops and restarts every running child when one of them
+	// fails.
+	OneForAll
+
+	// RestForOne stops and restarts the failed child and every child
+	// that was started after it.
+	RestForOne
+)
+
+// String returns the name of the strategy.
+func (s Strategy) String() string {
+	switch s {
+	case OneForOne:
+		return "one_for_one"
+	case OneForAll:
+		return "one_for_all"
+	case RestForOne:
+		return "rest_for_one"
+	default:
+		return fmt.Sprintf("Strategy(%d)", int(s))
+	}
+}
+
+// RestartType defines when a child of a Supervisor gets restarted.
+type RestartType int
+
+const (
+	// Transient children are only restarted when they return an error.
+	// A child that returns nil is considered done.
+	Transient RestartType = iota
+
+	// Permanent children are always restarted, even when they return nil.
+	Permanent
+
+	// Temporary children are never restarted. Their failures are logged
+	// and otherwise ignored.
+	Temporary
+)
+
+// Child is a named runner managed by a Supervisor.
+type Child struct {
+	// Name identifies the child in logs and traces.
+	Name string
+
+	// Runner is the runner to supervise. It is reused across restarts
+	// when New is nil, so its Close must be safe to call more than once.
+	Runner Runner
+
+	// New creates a fresh runner for every (re)start. Prefer this for
+	// runners whose Close cannot be called twice, like most
+	// serviceactivities.
+	New func() Runner
+
+	// Restart defines when the child gets restarted.
+	Restart RestartType
+}
+
+// runner returns the runner to use for the next start of the child.
+func (c *Child) runner() Runner {
+	if c.New != nil {
+		return c.New()
+	}
+	return c.Runner
+}
+
+// SupervisorOptions contains the options for a Supervisor.
+type SupervisorOptions struct {
+	// Strategy is the restart strategy, OneForOne by default.
+	Strategy Strategy
+
+	// RestartPolicy defines the backoff between restarts and the restart
+	// intensity (MaxRestarts within Window) after which the supervisor
+	// gives up. It applies to the supervisor as a whole, not per child.
+	// DefaultRestartPolicy is used by default.
+	RestartPolicy RestartPolicy
+}
+
+// SupervisorOption configures a Supervisor.
+type SupervisorOption func(*SupervisorOptions)
+
+// WithStrategy sets the restart strategy of a Supervisor.
+func WithStrategy(s Strategy) SupervisorOption {
+	return func(opts *SupervisorOptions) {
+		opts.Strategy = s
+	}
+}
+
+// WithSupervisorRestartPolicy sets the restart policy of a Supervisor.
+func WithSupervisorRestartPolicy(p RestartPolicy) SupervisorOption {
+	return func(opts *SupervisorOptions) {
+		opts.RestartPolicy = p
+	}
+}
+
+// _ ensures that Supervisor implements the Runner interface.
+var _ Runner = (*Supervisor)(nil)
+
+// _ ensures that Supervisor implements the Closer interface.
+var _ Closer = (*Supervisor)(nil)
+
+// Supervisor runs a set of named children and restarts them according to
+// a Strategy when they fail, instead of tearing everything down like
+// RunGroup does.
+//
+// Children are started in order and stopped in reverse order. A child is
+// stopped by canceling its context. RunClose is called on every child
+// after its Run returns, before it is restarted. A panicking child is
+// recovered, see RecoverPanic, and handled like a child returning a
+// PanicError.
+//
+// A child returning an orerr.ShutdownError is never restarted: the
+// supervisor stops all children and returns that error, which keeps
+// shutdown.HandleShutdownConditions working for supervised services.
+//
+// Supervisors implement Runner, so they can be nested to build trees.
+//
+//	s := async.NewSupervisor("service", []async.Child{
+//	    {Name: "shutdown", New: func() async.Runner { return shutdown.New() }},
+//	    {Name: "gomaxprocs", New: func() async.Runner { return gomaxprocs.New() }},
+//	    {Name: "cleanup", New: func() async.Runner { return cronjob.New(newJob, "@hourly") }},
+//	}, async.WithStrategy(async.OneForOne))
+//
+//	err := s.Run(ctx)
+//	shutdown.HandleShutdownConditions(ctx, err)
+type Supervisor struct {
+	name     string
+	children []Child
+	opts     *SupervisorOptions
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewSupervisor creates a new supervisor for the provided children.
+func NewSupervisor(name string, children []Child, options ...SupervisorOption) *Supervisor {
+	opts := &SupervisorOptions{
+		Strategy:      OneForOne,
+		RestartPolicy: DefaultRestartPolicy,
+	}
+	for _, o := range options {
+		o(opts)
+	}
+
+	return &Supervisor{
+		name:     name,
+		children: children,
+		opts:     opts,
+		done:     make(chan struct{}),
+	}
+}
+
+// supervisedChild tracks a single running instance of a child.
+type supervisedChild struct {
+	runner  Runner
+	cancel  context.CancelFunc
+	stopped chan struct{}
+	running bool
+	gen     int
+}
+
+// childExit is sent by a child goroutine when its Run returns.
+type childExit struct {
+	index int
+	gen   int
+	err   error
+}
+
+// Run starts all children and supervises them until the context is
+// canceled, the supervisor is closed, every child is done or the restart
+// intensity is exceeded.
+func (s *Supervisor) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	quit := make(chan struct{})
+	defer close(quit)
+
+	exits := make(chan childExit, len(s.children))
+	states := make([]supervisedChild, len(s.children))
+	rs := newRestarter(s.opts.RestartPolicy)
+
+	start := func(i int) {
+		st := &states[i]
+		cctx, ccancel := context.WithCancel(ctx)
+		st.runner = s.children[i].runner()
+		st.cancel = ccancel
+		st.stopped = make(chan struct{})
+		st.running = true
+		st.gen++
+
+		r, stopped, gen, name := st.runner, st.stopped, st.gen, s.children[i].Name
+		go func() {
+			err := func() (err error) {
+				ctx := trace.StartSpan(cctx, name)
+				defer trace.End(ctx)
+				// a panic is an abnormal exit, restarted like an error
+				defer RecoverPanic(ctx, "supervisor", &err)
+				return r.Run(ctx)
+			}()
+
+			// signal stop before reporting the exit so that stop never
+			// waits on a child blocked on the exits channel.
+			close(stopped)
+			select {
+			case exits <- childExit{index: i, gen: gen, err: err}:
+			case <-quit:
+			}
+		}()
+	}
+
+	// stop cancels a running child and waits for its Run to return.
+	stop := func(i int) {
+		st := &states[i]
+		if !st.running {
+			return
+		}
+		st.cancel()
+		<-st.stopped
+		st.running = false
+		s.close(ctx, i, st.runner)
+	}
+
+	stopAll := func() {
+		for i := len(states) - 1; i >= 0; i-- {
+			stop(i)
+		}
+	}
+
+	for i := range s.children {
+		start(i)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			stopAll()
+			return ctx.Err()
+		case <-s.done:
+			stopAll()
+			return nil
+		case e := <-exits:
+			st := &states[e.index]
+			if !st.running || e.gen != st.gen {
+				// stopped on purpose, already handled.
+				continue
+			}
+			st.running = false
+			st.cancel()
+			s.close(ctx, e.index, st.runner)
+
+			child := s.children[e.index]
+			var shutdownErr orerr.ShutdownError
+			if errors.As(e.err, &shutdownErr) {
+				stopAll()
+				return e.err
+			}
+
+			if !s.shouldRestart(child, e.err) {
+				if e.err != nil {
+					log.Error(ctx, "async.supervisor child failed", s.fields(child), events.NewErrorInfo(e.err))
+				}
+				if s.allDone(states) {
+					return nil
+				}
+				continue
+			}
+
+			delay, ok := rs.next(time.Now())
+			if !ok {
+				stopAll()
+				err := fmt.Errorf("%s: restart intensity exceeded after %d restarts: %w", s.name, rs.attempt, e.err)
+				log.Error(ctx, "async.supervisor gave up", log.F{"supervisor": s.name}, events.NewErrorInfo(err))
+				return err
+			}
+
+			restart := []int{e.index}
+			switch s.opts.Strategy {
+			case OneForAll:
+				restart = s.stopFrom(0, e.index, states, stop)
+			case RestForOne:
+				restart = s.stopFrom(e.index, e.index, states, stop)
+			case OneForOne:
+			}
+
+			log.Warn(ctx, "async.supervisor restarting", s.fields(child), log.F{
+				"async.supervisor.strategy": s.opts.Strategy.String(),
+				"async.restart.attempt":     rs.attempt,
+				"async.restart.backoff":     delay.String(),
+				"async.restart.children":    len(restart),
+			}, events.NewErrorInfo(e.err))
+
+			select {
+			case <-ctx.Done():
+				continue
+			case <-s.done:
+				continue
+			case <-time.After(delay):
+			}
+			for _, i := range restart {
+				start(i)
+			}
+		}
+	}
+}
+
+// Close stops the supervisor and all of its children.
+func (s *Supervisor) Close(_ context.Context) error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	return nil
+}
+
+// stopFrom stops every running child from index first onward (in
+// reverse order) and returns the indexes of the children to restart,
+// which always include the failed one.
+func (s *Supervisor) stopFrom(first, failed int, states []supervisedChild, stop func(int)) []int {
+	restart := []int{}
+	for i := len(states) - 1; i >= first; i-- {
+		if i == failed || states[i].running {
+			restart = append([]int{i}, restart...)
+		}
+		stop(i)
+	}
+	return restart
+}
+
+// shouldRestart decides whether a child that exited with err needs to be
+// restarted.
+func (s *Supervisor) shouldRestart(child Child, err error) bool {
+	switch child.Restart {
+	case Permanent:
+		return true
+	case Temporary:
+		return false
+	case Transient:
+		return err != nil
+	default:
+		return err != nil
+	}
+}
+
+// allDone returns true when no child is running anymore.
+func (s *Supervisor) allDone(states []supervisedChild) bool {
+	for i := range states {
+		if states[i].running {
+			return false
+		}
+	}
+	return true
+}
+
+// close calls RunClose on a child runner that has returned.
+func (s *Supervisor) close(ctx context.Context, i int, r Runner) {
+	if err := RunClose(ctx, r); err != nil {
+		log.Error(ctx, "async.supervisor error when closing child", s.fields(s.children[i]), events.NewErrorInfo(err))
+	}
+}
+
+// fields returns the log fields identifying a child.
+func (s *Supervisor) fields(child Child) log.F {
+	return log.F{"supervisor": s.name, "child": child.Name}
+}
@@ -0,0 +1,183 @@
+package async_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grevych/gobox/pkg/async"
+	"github.com/grevych/gobox/pkg/orerr"
+	"gotest.tools/v3/assert"
+)
+
+// countingRunner counts its runs and closes. It fails while fail
+// returns true and blocks until canceled otherwise.
+type countingRunner struct {
+	runs   atomic.Int32
+	closes atomic.Int32
+	fail   func(run int32) bool
+}
+
+func (r *countingRunner) Run(ctx context.Context) error {
+	run := r.runs.Add(1)
+	if r.fail != nil && r.fail(run) {
+		return errors.New("child failed")
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (r *countingRunner) Close(_ context.Context) error {
+	r.closes.Add(1)
+	return nil
+}
+
+var fastRestarts = async.RestartPolicy{InitialBackoff: time.Millisecond}
+
+// runSupervisor runs s until cond is true and returns the error returned
+// by the supervisor.
+func runSupervisor(t *testing.T, s *async.Supervisor, cond func() bool) error {
+	t.Helper()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.Run(context.Background())
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition never met")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	assert.NilError(t, s.Close(context.Background()))
+	return <-errc
+}
+
+func TestSupervisor_OneForOne(t *testing.T) {
+	flaky := &countingRunner{fail: func(run int32) bool { return run <= 2 }}
+	stable := &countingRunner{}
+
+	s := async.NewSupervisor("test", []async.Child{
+		{Name: "stable", Runner: stable},
+		{Name: "flaky", Runner: flaky},
+	}, async.WithSupervisorRestartPolicy(fastRestarts))
+
+	err := runSupervisor(t, s, func() bool { return flaky.runs.Load() == 3 })
+	assert.NilError(t, err)
+	assert.Equal(t, int32(1), stable.runs.Load())
+	assert.Equal(t, int32(1), stable.closes.Load())
+	assert.Equal(t, int32(3), flaky.closes.Load())
+}
+
+func TestSupervisor_RestartsPanickingChild(t *testing.T) {
+	panicking := &countingRunner{fail: func(run int32) bool {
+		if run == 1 {
+			panic("child panicked")
+		}
+		return false
+	}}
+
+	s := async.NewSupervisor("test", []async.Child{
+		{Name: "panicking", Runner: panicking},
+	}, async.WithSupervisorRestartPolicy(fastRestarts))
+
+	err := runSupervisor(t, s, func() bool { return panicking.runs.Load() == 2 })
+	assert.NilError(t, err)
+	assert.Equal(t, int32(2), panicking.closes.Load())
+}
+
+func TestSupervisor_OneForAll(t *testing.T) {
+	flaky := &countingRunner{fail: func(run int32) bool { return run == 1 }}
+	first := &countingRunner{}
+	last := &countingRunner{}
+
+	s := async.NewSupervisor("test", []async.Child{
+		{Name: "first", Runner: first},
+		{Name: "flaky", Runner: flaky},
+		{Name: "last", Runner: last},
+	}, async.WithStrategy(async.OneForAll), async.WithSupervisorRestartPolicy(fastRestarts))
+
+	err := runSupervisor(t, s, func() bool { return flaky.runs.Load() == 2 && last.runs.Load() == 2 })
+	assert.NilError(t, err)
+	assert.Equal(t, int32(2), first.runs.Load())
+	assert.Equal(t, int32(2), first.closes.Load())
+}
+
+func TestSupervisor_RestForOne(t *testing.T) {
+	flaky := &countingRunner{fail: func(run int32) bool { return run == 1 }}
+	first := &countingRunner{}
+	last := &countingRunner{}
+
+	s := async.NewSupervisor("test", []async.Child{
+		{Name: "first", Runner: first},
+		{Name: "flaky", Runner: flaky},
+		{Name: "last", Runner: last},
+	}, async.WithStrategy(async.RestForOne), async.WithSupervisorRestartPolicy(fastRestarts))
+
+	err := runSupervisor(t, s, func() bool { return flaky.runs.Load() == 2 && last.runs.Load() == 2 })
+	assert.NilError(t, err)
+	assert.Equal(t, int32(1), first.runs.Load())
+}
+
+func TestSupervisor_NewRunnerPerRestart(t *testing.T) {
+	created := atomic.Int32{}
+	s := async.NewSupervisor("test", []async.Child{{
+		Name: "flaky",
+		New: func() async.Runner {
+			n := created.Add(1)
+			return &countingRunner{fail: func(int32) bool { return n <= 2 }}
+		},
+	}}, async.WithSupervisorRestartPolicy(fastRestarts))
+
+	err := runSupervisor(t, s, func() bool { return created.Load() == 3 })
+	assert.NilError(t, err)
+}
+
+func TestSupervisor_IntensityExceeded(t *testing.T) {
+	flaky := &countingRunner{fail: func(int32) bool { return true }}
+	stable := &countingRunner{}
+
+	s := async.NewSupervisor("test", []async.Child{
+		{Name: "stable", Runner: stable},
+		{Name: "flaky", Runner: flaky},
+	}, async.WithSupervisorRestartPolicy(async.RestartPolicy{
+		InitialBackoff: time.Millisecond,
+		MaxRestarts:    3,
+		Window:         time.Minute,
+	}))
+
+	err := s.Run(context.Background())
+	assert.ErrorContains(t, err, "test: restart intensity exceeded after 3 restarts: child failed")
+	assert.Equal(t, int32(4), flaky.runs.Load())
+	assert.Equal(t, int32(1), stable.closes.Load())
+}
+
+func TestSupervisor_ShutdownErrorStopsEverything(t *testing.T) {
+	stable := &countingRunner{}
+	s := async.NewSupervisor("test", []async.Child{
+		{Name: "stable", Runner: stable},
+		{Name: "shutdown", Restart: async.Permanent, Runner: async.Func(func(context.Context) error {
+			return orerr.ShutdownError{Err: errors.New("signal")}
+		})},
+	})
+
+	err := s.Run(context.Background())
+	assert.Assert(t, errors.As(err, &orerr.ShutdownError{}))
+	assert.Equal(t, int32(1), stable.closes.Load())
+}
+
+func TestSupervisor_TransientChildDone(t *testing.T) {
+	s := async.NewSupervisor("test", []async.Child{
+		{Name: "done", Runner: async.Func(func(context.Context) error { return nil })},
+		{Name: "temporary", Restart: async.Temporary, Runner: async.Func(func(context.Context) error {
+			return errors.New("child failed")
+		})},
+	})
+
+	assert.NilError(t, s.Run(context.Background()))
+}
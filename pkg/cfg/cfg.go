@@ -48,13 +48,45 @@
 //
 // To build with this override, the build tag gobox_dev should be used.
 //
-// Dev environments may also need command line or environment
-// overrides.  The suggested mechanism is to add the override as part
-// of the individual `Load()` method on the struct.  At some point, we
-// will add code generators for config (based on struct tags such as
-// `env:OUTREACH_HONEYCOMB_KEY` or some such mechanism) and the
-// `Load()` methods will be automatically generated with the specified
-// overrides.
+// # Environment overrides and defaults
+//
+// After decoding the config file, Load applies the `env` and `default`
+// struct tags of the config, including the tags of nested structs. A
+// field with an `env` tag is set from the named environment variable
+// when that variable is not empty, which takes precedence over the
+// config file. A field with a `default` tag is set to its default when
+// it is still empty.
+//
+//	type OtelConfig struct {
+//	   Disable    bool          `yaml:"Disable" env:"OTEL_DISABLE"`
+//	   Endpoint   string        `yaml:"APIHost" default:"api.honeycomb.io"`
+//	   Timeout    time.Duration `yaml:"Timeout" default:"5s"`
+//	   Tags       []string      `yaml:"Tags" env:"OTEL_TAGS"`
+//	   Key        cfg.Secret    `yaml:"Key" env:"OTEL_KEY_PATH"`
+//	}
+//
+// Values are parsed according to the type of the field: slices are
+// comma-separated, durations use time.ParseDuration, a cfg.Secret is set
+// to the path of the secret, and types implementing
+// encoding.TextUnmarshaler parse themselves.
+//
+// # Hot reload
+//
+// Watch loads a config like Load, then keeps watching the config file
+// and hands the previous and the new config to a subscriber on every
+// change. A config file that cannot be decoded, or whose config fails
+// its Validate method (see Validator), is logged and ignored.
+//
+//	var hcConfig OtelConfig
+//	err := cfg.Watch(ctx, "trace.yaml", &hcConfig, func(old, new OtelConfig) {
+//	    if old.SampleRate != new.SampleRate {
+//	        sampler.SetRate(new.SampleRate)
+//	    }
+//	})
+//
+// For more control, such as several subscribers or running the watch as
+// a service activity (see serviceactivities/configwatcher), use a
+// Watcher.
 //
 // # Secrets
 //
@@ -101,16 +133,24 @@ type Reader func(fileName string) ([]byte, error)
 //	var appConfig MyConfig
 //	err := cfg.Load("myapp.json", &appConfig)
 //
-// This parses the config using JSON.  If a config has special needs,
-// it can implement its own UnmarshalJSON (such as implementing
-// environment overrides)
+// This parses the config using YAML, then applies the `env` and
+// `default` struct tags of the config. If a config has special needs,
+// it can implement its own UnmarshalYAML.
 func (r Reader) Load(fileName string, ptr interface{}) error {
 	data, err := r(fileName)
 	if err != nil {
 		return err
 	}
 
-	return yaml.Unmarshal(data, ptr)
+	return decode(data, ptr)
+}
+
+// decode parses the config using YAML, then applies its struct tags.
+func decode(data []byte, ptr interface{}) error {
+	if err := yaml.Unmarshal(data, ptr); err != nil {
+		return err
+	}
+	return applyTags(ptr)
 }
 
 // Load uses the default config reader to load config
@@ -0,0 +1,190 @@
+// Copyright 2022 Outreach Corporation. All Rights Reserved.
+
+// Description: Implements the env and default struct tags of configurations
+package cfg
+
+import (
+	"encoding"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// This section defines the struct tags applied by Load.
+const (
+	// envTag names the environment variable overriding a field.
+	envTag = "env"
+
+	// defaultTag holds the value of a field left empty by the config
+	// file and the environment.
+	defaultTag = "default"
+)
+
+// nolint:gochecknoglobals // Why: reflect types are constants
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	secretType          = reflect.TypeOf(Secret{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// applyTags applies the env and default tags of the struct ptr points
+// to, recursively.
+func applyTags(ptr interface{}) error {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return nil
+	}
+	_, err := applyStructTags(v.Elem(), "", map[reflect.Type]bool{})
+	return err
+}
+
+// applyStructTags applies the tags of the fields of a struct. It returns
+// true if a field was set from the environment. allocating holds the
+// types of the nil pointers allocated on the current path.
+func applyStructTags(v reflect.Value, path string, allocating map[reflect.Type]bool) (bool, error) {
+	if v.Kind() != reflect.Struct {
+		return false, nil
+	}
+
+	set := false
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+		name := path + field.Name
+
+		envName, hasEnv := field.Tag.Lookup(envTag)
+		def, hasDefault := field.Tag.Lookup(defaultTag)
+		if value := os.Getenv(envName); hasEnv && value != "" {
+			if err := setField(fv, value); err != nil {
+				return set, errors.Wrapf(err, "failed to set %s from environment variable %s", name, envName)
+			}
+			set = true
+			continue
+		}
+		if hasDefault && fv.IsZero() {
+			if err := setField(fv, def); err != nil {
+				return set, errors.Wrapf(err, "failed to set %s to its default", name)
+			}
+			continue
+		}
+
+		nestedSet, err := applyNestedTags(fv, name+".", allocating)
+		if err != nil {
+			return set, err
+		}
+		set = set || nestedSet
+	}
+	return set, nil
+}
+
+// applyNestedTags applies the tags of a nested struct, or of the struct
+// a pointer points to. A nil pointer is only allocated if a field of its
+// struct is set from the environment, defaults alone leave it nil.
+//
+// A nil pointer to a type already allocated on the current path is left
+// nil, so that recursive types like linked lists only get one level.
+func applyNestedTags(v reflect.Value, path string, allocating map[reflect.Type]bool) (bool, error) {
+	switch {
+	case v.Type() == secretType:
+		return false, nil
+	case v.Kind() == reflect.Struct:
+		return applyStructTags(v, path, allocating)
+	case v.Kind() == reflect.Ptr && v.Type().Elem().Kind() == reflect.Struct:
+		if !v.IsNil() {
+			return applyStructTags(v.Elem(), path, allocating)
+		}
+		elem := v.Type().Elem()
+		if allocating[elem] {
+			return false, nil
+		}
+		allocating[elem] = true
+		defer delete(allocating, elem)
+
+		nested := reflect.New(elem)
+		set, err := applyStructTags(nested.Elem(), path, allocating)
+		if set && err == nil {
+			v.Set(nested)
+		}
+		return set, err
+	}
+	return false, nil
+}
+
+// setField parses value into a field. Slices are comma-separated, and a
+// Secret is set to the path of the secret.
+func setField(v reflect.Value, value string) error {
+	if v.Kind() == reflect.Ptr {
+		ptr := reflect.New(v.Type().Elem())
+		if err := setField(ptr.Elem(), value); err != nil {
+			return err
+		}
+		v.Set(ptr)
+		return nil
+	}
+
+	if reflect.PointerTo(v.Type()).Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+
+	switch {
+	case v.Type() == secretType:
+		v.Set(reflect.ValueOf(Secret{Path: value}))
+		return nil
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() { //nolint:exhaustive // Why: other kinds are not supported
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		parts := strings.Split(value, ",")
+		slice := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setField(slice.Index(i), strings.TrimSpace(part)); err != nil {
+				return errors.Wrapf(err, "element %d", i)
+			}
+		}
+		v.Set(slice)
+	default:
+		return errors.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package cfg_test
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/grevych/gobox/pkg/cfg"
+)
+
+type TagsExporter struct {
+	Endpoint string        `yaml:"Endpoint" env:"TEST_CFG_ENDPOINT" default:"localhost:4317"`
+	Timeout  time.Duration `yaml:"Timeout" default:"5s"`
+	Headers  []string      `yaml:"Headers" env:"TEST_CFG_HEADERS"`
+}
+
+type tagsConfig struct {
+	TagsExporter `yaml:",inline"`
+
+	Enabled    bool          `yaml:"Enabled" env:"TEST_CFG_ENABLED"`
+	SampleRate float64       `yaml:"SampleRate" env:"TEST_CFG_SAMPLE_RATE" default:"0.5"`
+	Ports      []int         `yaml:"Ports" default:"80, 443"`
+	Key        cfg.Secret    `yaml:"Key" env:"TEST_CFG_KEY_PATH"`
+	Exporter   TagsExporter  `yaml:"Exporter"`
+	Backup     *TagsExporter `yaml:"Backup"`
+	Fallback   *TagsExporter `yaml:"Fallback"`
+	Retries    *int          `yaml:"Retries" env:"TEST_CFG_RETRIES"`
+}
+
+// yamlReader is a reader returning the same YAML for every file.
+func yamlReader(data string) cfg.Reader {
+	return func(string) ([]byte, error) {
+		return []byte(data), nil
+	}
+}
+
+func TestLoad_Tags(t *testing.T) {
+	t.Setenv("TEST_CFG_ENABLED", "true")
+	t.Setenv("TEST_CFG_KEY_PATH", "/run/secrets/key")
+	t.Setenv("TEST_CFG_HEADERS", "a=1, b=2")
+	t.Setenv("TEST_CFG_SAMPLE_RATE", "")
+	t.Setenv("TEST_CFG_RETRIES", "3")
+
+	var c tagsConfig
+	err := yamlReader(`
+Enabled: false
+Endpoint: from-yaml:4317
+Timeout: 1m
+Key:
+  Path: /from/yaml
+Exporter:
+  Timeout: 10s
+Backup:
+  Endpoint: backup:4317
+`).Load("test.yaml", &c)
+	assert.NilError(t, err)
+
+	retries := 3
+	assert.DeepEqual(t, c, tagsConfig{
+		TagsExporter: TagsExporter{
+			Endpoint: "from-yaml:4317",
+			Timeout:  time.Minute,
+			Headers:  []string{"a=1", "b=2"},
+		},
+		Enabled:    true,
+		SampleRate: 0.5,
+		Ports:      []int{80, 443},
+		Key:        cfg.Secret{Path: "/run/secrets/key"},
+		Exporter: TagsExporter{
+			Endpoint: "localhost:4317",
+			Timeout:  10 * time.Second,
+			Headers:  []string{"a=1", "b=2"},
+		},
+		Backup: &TagsExporter{
+			Endpoint: "backup:4317",
+			Timeout:  5 * time.Second,
+			Headers:  []string{"a=1", "b=2"},
+		},
+		Fallback: &TagsExporter{
+			Endpoint: "localhost:4317",
+			Timeout:  5 * time.Second,
+			Headers:  []string{"a=1", "b=2"},
+		},
+		Retries: &retries,
+	})
+
+	// defaults alone do not allocate nil structs
+	t.Setenv("TEST_CFG_HEADERS", "")
+	c = tagsConfig{}
+	assert.NilError(t, yamlReader("Enabled: true").Load("test.yaml", &c))
+	assert.Assert(t, c.Backup == nil && c.Fallback == nil)
+	assert.Equal(t, c.Exporter.Timeout, 5*time.Second)
+}
+
+type tagsNode struct {
+	Name string    `yaml:"Name" env:"TEST_CFG_NODE_NAME" default:"node"`
+	Next *tagsNode `yaml:"Next"`
+}
+
+func TestLoad_TagsRecursive(t *testing.T) {
+	var c tagsNode
+	assert.NilError(t, yamlReader("Next:\n  Next:\n    Name: third").Load("test.yaml", &c))
+	assert.Equal(t, c.Name, "node")
+	assert.Equal(t, c.Next.Name, "node")
+	assert.Equal(t, c.Next.Next.Name, "third")
+	assert.Assert(t, c.Next.Next.Next == nil)
+
+	// the environment allocates one level of nil pointers, not infinitely many
+	t.Setenv("TEST_CFG_NODE_NAME", "env")
+	c = tagsNode{}
+	assert.NilError(t, yamlReader("").Load("test.yaml", &c))
+	assert.Equal(t, c.Name, "env")
+	assert.Equal(t, c.Next.Name, "env")
+	assert.Assert(t, c.Next.Next == nil)
+}
+
+func TestLoad_TagsErrors(t *testing.T) {
+	t.Setenv("TEST_CFG_SAMPLE_RATE", "high")
+
+	var c tagsConfig
+	err := yamlReader("Enabled: true").Load("test.yaml", &c)
+	assert.ErrorContains(t, err, "failed to set SampleRate from environment variable TEST_CFG_SAMPLE_RATE")
+
+	var bad struct {
+		Timeout time.Duration `default:"soon"`
+	}
+	err = yamlReader("").Load("test.yaml", &bad)
+	assert.ErrorContains(t, err, "failed to set Timeout to its default")
+}
@@ -0,0 +1,250 @@
+// Copyright 2022 Outreach Corporation. All Rights Reserved.
+
+// Description: Implements hot reloading of configurations
+package cfg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/grevych/gobox/pkg/events"
+	"github.com/grevych/gobox/pkg/log"
+)
+
+// DefaultWatchInterval is the default interval between two reads of a
+// watched config file.
+const DefaultWatchInterval = 10 * time.Second
+
+// Validator is implemented by configs that check their own values. A
+// Watcher ignores a new config whose Validate method fails.
+type Validator interface {
+	Validate() error
+}
+
+// WatchOption configures a Watcher.
+type WatchOption func(*watchOptions)
+
+// watchOptions holds the options of a Watcher.
+type watchOptions struct {
+	reader   Reader
+	interval time.Duration
+}
+
+// WithWatchReader sets the reader of the config file. It defaults to the
+// default reader when the Watcher is created.
+func WithWatchReader(r Reader) WatchOption {
+	return func(opts *watchOptions) {
+		opts.reader = r
+	}
+}
+
+// WithWatchInterval sets the interval between two reads of the config
+// file.
+func WithWatchInterval(d time.Duration) WatchOption {
+	return func(opts *watchOptions) {
+		opts.interval = d
+	}
+}
+
+// Watcher keeps a config up to date with its config file.
+//
+// The Watcher reads the config file at the watch interval and compares
+// its content with the previous one, rather than relying on
+// modification times or file events, so that it sees the atomic
+// symlink swaps used by Kubernetes to update ConfigMap volumes.
+//
+// A Watcher implements async.Runner.
+type Watcher[T any] struct {
+	fileName string
+	opts     watchOptions
+
+	lock    sync.RWMutex
+	current T
+	data    []byte
+
+	subscribers []watchSubscriber[T]
+	lastID      int
+}
+
+// watchSubscriber is a function subscribed to a Watcher.
+type watchSubscriber[T any] struct {
+	id int
+	fn func(old, new T)
+}
+
+// NewWatcher creates a Watcher of a config file. Call Load to load the
+// config, and Run to watch the config file.
+func NewWatcher[T any](fileName string, options ...WatchOption) *Watcher[T] {
+	opts := watchOptions{reader: defaultReader, interval: DefaultWatchInterval}
+	for _, opt := range options {
+		opt(&opts)
+	}
+	return &Watcher[T]{fileName: fileName, opts: opts}
+}
+
+// Load loads the config from the config file.
+func (w *Watcher[T]) Load() error {
+	data, err := w.opts.reader(w.fileName)
+	if err != nil {
+		return err
+	}
+	config, err := w.decode(data)
+	if err != nil {
+		return err
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.current, w.data = config, data
+	return nil
+}
+
+// decode decodes and validates a config. A panic of the Validate method
+// is returned as an error.
+func (w *Watcher[T]) decode(data []byte) (config T, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	if err := decode(data, &config); err != nil {
+		return config, err
+	}
+	if v, ok := interface{}(&config).(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return config, err
+		}
+	}
+	return config, nil
+}
+
+// Get returns the current config.
+func (w *Watcher[T]) Get() T {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.current
+}
+
+// Subscribe registers a function called with the previous and the new
+// config after every change of the config. The functions are called in
+// the goroutine of Run, in the order they subscribed. A panic of a
+// function is logged, and the next functions are still called.
+// Subscribe returns a function unregistering fn.
+func (w *Watcher[T]) Subscribe(fn func(old, new T)) (unsubscribe func()) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.lastID++
+	id := w.lastID
+	w.subscribers = append(w.subscribers, watchSubscriber[T]{id: id, fn: fn})
+	return func() {
+		w.lock.Lock()
+		defer w.lock.Unlock()
+		for i, s := range w.subscribers {
+			if s.id == id {
+				w.subscribers = append(w.subscribers[:i:i], w.subscribers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Run watches the config file until the context is done, and returns
+// the context error.
+func (w *Watcher[T]) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.opts.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.reload(ctx)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// reload reads the config file and notifies the subscribers if the
+// config changed. A config that cannot be read, decoded or validated is
+// logged and the current one is kept.
+func (w *Watcher[T]) reload(ctx context.Context) {
+	data, err := w.opts.reader(w.fileName)
+	if err != nil {
+		// the file can be missing for a moment while it is replaced,
+		// read it again on the next tick
+		log.Warn(ctx, "failed to read config", log.F{"cfg.file": w.fileName}, events.NewErrorInfo(err))
+		return
+	}
+
+	w.lock.Lock()
+	if bytes.Equal(data, w.data) {
+		w.lock.Unlock()
+		return
+	}
+	// remember the content even if it is rejected, to only log it once
+	w.data = data
+	w.lock.Unlock()
+
+	config, err := w.decode(data)
+	if err != nil {
+		log.Error(ctx, "rejected config", log.F{"cfg.file": w.fileName}, events.NewErrorInfo(err))
+		return
+	}
+
+	w.lock.Lock()
+	old := w.current
+	if reflect.DeepEqual(old, config) {
+		// e.g. a rejected config reverted to the current one
+		w.lock.Unlock()
+		return
+	}
+	w.current = config
+	subscribers := w.subscribers
+	w.lock.Unlock()
+
+	log.Info(ctx, "reloaded config", log.F{"cfg.file": w.fileName})
+	for _, s := range subscribers {
+		w.notify(ctx, s.fn, old, config)
+	}
+}
+
+// notify calls a subscriber, logging its panic.
+func (w *Watcher[T]) notify(ctx context.Context, fn func(old, new T), old, config T) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error(ctx, "config subscriber panicked", log.F{"cfg.file": w.fileName}, events.NewErrorInfoFromPanic(r))
+		}
+	}()
+	fn(old, config)
+}
+
+// Watch loads the config into ptr like Load, then watches the config
+// file until the context is done, calling onChange with the previous and
+// the new config after every change. ptr is only written before Watch
+// returns, later configs are only handed to onChange, which is called
+// from another goroutine. Use a Watcher to get the current config at any
+// time.
+//
+// Watch returns an error if the initial config cannot be loaded or
+// fails its Validate method. Later configs that cannot be loaded are
+// logged and ignored, see Watcher.
+//
+// The config file is watched in a goroutine without a trace span, as
+// this package cannot depend on the async and trace packages. To watch
+// it as a traced service activity, use a Watcher with
+// serviceactivities/configwatcher.
+func Watch[T any](ctx context.Context, fileName string, ptr *T, onChange func(old, new T)) error {
+	w := NewWatcher[T](fileName)
+	if err := w.Load(); err != nil {
+		return err
+	}
+	*ptr = w.Get()
+	w.Subscribe(onChange)
+
+	go w.Run(ctx) //nolint:errcheck // Why: only returns the context error
+	return nil
+}
@@ -0,0 +1,143 @@
+package cfg_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/grevych/gobox/pkg/cfg"
+)
+
+type watchedConfig struct {
+	Workers int `yaml:"Workers"`
+}
+
+func (c *watchedConfig) Validate() error {
+	if c.Workers <= 0 {
+		return errors.New("Workers must be positive")
+	}
+	return nil
+}
+
+// configMap mimics a Kubernetes ConfigMap volume: the config file is a
+// symlink to the ..data symlink, which is atomically swapped to point
+// to a new directory on every update.
+type configMap struct {
+	t       *testing.T
+	dir     string
+	version int
+}
+
+// update atomically replaces the content of the config file.
+func (m *configMap) update(content string) {
+	m.version++
+	version := filepath.Join(m.dir, "..v"+string(rune('0'+m.version)))
+	assert.NilError(m.t, os.Mkdir(version, 0o755))
+	assert.NilError(m.t, os.WriteFile(filepath.Join(version, "app.yaml"), []byte(content), 0o644))
+
+	tmp := filepath.Join(m.dir, "..data_tmp")
+	assert.NilError(m.t, os.Symlink(filepath.Base(version), tmp))
+	assert.NilError(m.t, os.Rename(tmp, filepath.Join(m.dir, "..data")))
+}
+
+func newConfigMap(t *testing.T, content string) *configMap {
+	m := &configMap{t: t, dir: t.TempDir()}
+	m.update(content)
+	assert.NilError(t, os.Symlink(filepath.Join("..data", "app.yaml"), filepath.Join(m.dir, "app.yaml")))
+	return m
+}
+
+func (m *configMap) reader() cfg.Reader {
+	return func(fileName string) ([]byte, error) {
+		return os.ReadFile(filepath.Join(m.dir, fileName))
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	m := newConfigMap(t, "Workers: 1")
+	w := cfg.NewWatcher[watchedConfig]("app.yaml", cfg.WithWatchReader(m.reader()), cfg.WithWatchInterval(5*time.Millisecond))
+	assert.NilError(t, w.Load())
+	assert.Equal(t, w.Get().Workers, 1)
+
+	type change struct{ old, new int }
+	changes := make(chan change, 10)
+	// a panicking subscriber does not stop the others, nor the watch
+	w.Subscribe(func(old, new watchedConfig) {
+		panic("oh no")
+	})
+	w.Subscribe(func(old, new watchedConfig) {
+		changes <- change{old.Workers, new.Workers}
+	})
+	unsubscribe := w.Subscribe(func(old, new watchedConfig) {
+		t.Error("unsubscribed function called")
+	})
+	unsubscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+
+	m.update("Workers: 2")
+	assert.Equal(t, <-changes, change{1, 2})
+	assert.Equal(t, w.Get().Workers, 2)
+
+	// broken and invalid configs are ignored, as well as going back to
+	// the current config
+	m.update("Workers: [")
+	time.Sleep(30 * time.Millisecond)
+	m.update("Workers: 0")
+	time.Sleep(30 * time.Millisecond)
+	m.update("Workers: 2")
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, len(changes), 0)
+	assert.Equal(t, w.Get().Workers, 2)
+
+	m.update("Workers: 3")
+	assert.Equal(t, <-changes, change{2, 3})
+
+	cancel()
+	assert.Equal(t, <-done, context.Canceled)
+}
+
+func TestWatch(t *testing.T) {
+	m := newConfigMap(t, "Workers: 0")
+	defer cfg.SetDefaultReader(cfg.DefaultReader())
+	cfg.SetDefaultReader(m.reader())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	onChange := func(old, new watchedConfig) {}
+	var c watchedConfig
+	assert.ErrorContains(t, cfg.Watch(ctx, "app.yaml", &c, onChange), "Workers must be positive")
+
+	m.update("Workers: 4")
+	assert.NilError(t, cfg.Watch(ctx, "app.yaml", &c, onChange))
+	assert.Equal(t, c.Workers, 4)
+}
+
+type panickyConfig struct {
+	Workers int `yaml:"Workers"`
+}
+
+func (c *panickyConfig) Validate() error {
+	if c.Workers < 0 {
+		panic("negative workers")
+	}
+	return nil
+}
+
+func TestWatcher_ValidatePanics(t *testing.T) {
+	m := newConfigMap(t, "Workers: -1")
+	w := cfg.NewWatcher[panickyConfig]("app.yaml", cfg.WithWatchReader(m.reader()))
+	assert.ErrorContains(t, w.Load(), "panic: negative workers")
+
+	m.update("Workers: 1")
+	assert.NilError(t, w.Load())
+	assert.Equal(t, w.Get().Workers, 1)
+}
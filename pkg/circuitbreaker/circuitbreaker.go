@@ -0,0 +1,322 @@
+// Description: Provides a circuit breaker for outbound dependencies
+
+// Package circuitbreaker provides a circuit breaker for calls to
+// outbound dependencies.
+//
+// Failures are classified with orerr.ExtractErrorStatusCategory: only
+// server errors (including DeadlineExceeded and errors without a status
+// code) count toward tripping the breaker. Client errors and canceled
+// contexts do not, as they say nothing about the health of the
+// dependency.
+//
+//	breaker := circuitbreaker.New("billing", circuitbreaker.WithFailureThreshold(10))
+//
+//	err := breaker.Do(ctx, func(ctx context.Context) error {
+//	    return billing.Charge(ctx, invoice)
+//	})
+//
+// While the breaker is open, calls fail fast with an error wrapping
+// ErrOpen and the statuscodes.Unavailable status code.
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/grevych/gobox/pkg/app"
+	"github.com/grevych/gobox/pkg/log"
+	"github.com/grevych/gobox/pkg/orerr"
+	"github.com/grevych/gobox/pkg/statuscodes"
+)
+
+// ErrOpen is returned, wrapped with the statuscodes.Unavailable status
+// code, when a call is rejected by the breaker.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// breakerState registers the circuitbreaker_state metric for reporting
+// the current state of the breakers.
+var breakerState = promauto.NewGaugeVec( // nolint:gochecknoglobals // Why: cleaner to use everywhere
+	prometheus.GaugeOpts{
+		Name: "circuitbreaker_state",
+		Help: "The state of the circuit breaker: 0 closed, 1 open, 2 half-open",
+	},
+	[]string{"app", "breaker"}, // Labels
+)
+
+// breakerTransitions registers the circuitbreaker_transitions_total
+// metric for counting the state transitions of the breakers.
+var breakerTransitions = promauto.NewCounterVec( // nolint:gochecknoglobals // Why: cleaner to use everywhere
+	prometheus.CounterOpts{
+		Name: "circuitbreaker_transitions_total",
+		Help: "The number of state transitions of the circuit breaker",
+	},
+	[]string{"app", "breaker", "from", "to"}, // Labels
+)
+
+// State is the state of a Breaker.
+type State int
+
+// Contains the breaker states.
+const (
+	// Closed lets every call through.
+	Closed State = iota
+
+	// Open rejects every call.
+	Open
+
+	// HalfOpen lets a limited number of probe calls through to decide
+	// whether to close or to open again.
+	HalfOpen
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half_open"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// Options contains the options for a Breaker.
+type Options struct {
+	// FailureThreshold is the number of consecutive failures that opens
+	// the breaker, 5 by default.
+	FailureThreshold int
+
+	// OpenTimeout is how long the breaker stays open before letting
+	// probes through, 30 seconds by default.
+	OpenTimeout time.Duration
+
+	// ProbeBudget is the number of concurrent probe calls allowed while
+	// half-open, 1 by default.
+	ProbeBudget int
+
+	// SuccessThreshold is the number of successful probes that closes
+	// the breaker, 1 by default. Probes returning an error that is not a
+	// failure (see IsFailure) are not counted.
+	SuccessThreshold int
+}
+
+// Option configures a Breaker.
+type Option func(*Options)
+
+// WithFailureThreshold sets the number of consecutive failures that
+// opens the breaker.
+func WithFailureThreshold(n int) Option {
+	return func(opts *Options) {
+		opts.FailureThreshold = n
+	}
+}
+
+// WithOpenTimeout sets how long the breaker stays open before letting
+// probes through.
+func WithOpenTimeout(d time.Duration) Option {
+	return func(opts *Options) {
+		opts.OpenTimeout = d
+	}
+}
+
+// WithProbeBudget sets the number of concurrent probe calls allowed
+// while half-open.
+func WithProbeBudget(n int) Option {
+	return func(opts *Options) {
+		opts.ProbeBudget = n
+	}
+}
+
+// WithSuccessThreshold sets the number of successful probes that closes
+// the breaker.
+func WithSuccessThreshold(n int) Option {
+	return func(opts *Options) {
+		opts.SuccessThreshold = n
+	}
+}
+
+// Breaker is a circuit breaker. It is safe for concurrent use.
+type Breaker struct {
+	name string
+	opts *Options
+
+	mu        sync.Mutex
+	state     State
+	gen       int
+	failures  int
+	successes int
+	probes    int
+	openedAt  time.Time
+}
+
+// New creates a new closed breaker. The name identifies the breaker in
+// logs and metrics.
+func New(name string, options ...Option) *Breaker {
+	opts := &Options{
+		FailureThreshold: 5,
+		OpenTimeout:      30 * time.Second,
+		ProbeBudget:      1,
+		SuccessThreshold: 1,
+	}
+	for _, o := range options {
+		o(opts)
+	}
+
+	breakerState.WithLabelValues(app.Info().Name, name).Set(float64(Closed))
+	return &Breaker{name: name, opts: opts}
+}
+
+// Do calls fn if the breaker allows it and records its result. It
+// returns the error of fn, or an error wrapping ErrOpen when the call
+// is rejected. A panic in fn is recorded as a failure, then propagated.
+func (b *Breaker) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	done, err := b.Allow(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			// release the probe of a half-open breaker
+			done(ctx, fmt.Errorf("panic: %v", r))
+			panic(r)
+		}
+	}()
+	err = fn(ctx)
+	done(ctx, err)
+	return err
+}
+
+// Allow is the low-level version of Do, for calls that cannot be
+// wrapped in a function. If the call is allowed, done must be called
+// with its result.
+func (b *Breaker) Allow(ctx context.Context) (done func(ctx context.Context, err error), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open && time.Since(b.openedAt) >= b.opts.OpenTimeout {
+		b.transition(ctx, HalfOpen)
+	}
+
+	switch b.state {
+	case Open:
+		return nil, b.rejected()
+	case HalfOpen:
+		if b.probes >= b.opts.ProbeBudget {
+			return nil, b.rejected()
+		}
+		b.probes++
+	case Closed:
+	}
+
+	gen, state := b.gen, b.state
+	return func(ctx context.Context, err error) {
+		b.record(ctx, gen, state, err)
+	}, nil
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open && time.Since(b.openedAt) >= b.opts.OpenTimeout {
+		return HalfOpen
+	}
+	return b.state
+}
+
+// record records the result of a call allowed in state during
+// generation gen.
+func (b *Breaker) record(ctx context.Context, gen int, state State, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if gen != b.gen {
+		// the state changed while the call was running.
+		return
+	}
+
+	failed := IsFailure(err)
+	switch state {
+	case Closed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.opts.FailureThreshold {
+			b.transition(ctx, Open)
+		}
+	case HalfOpen:
+		b.probes--
+		if failed {
+			b.transition(ctx, Open)
+			return
+		}
+		if err != nil {
+			// a client error or a canceled probe says nothing about the
+			// health of the dependency, only release its slot
+			return
+		}
+		b.successes++
+		if b.successes >= b.opts.SuccessThreshold {
+			b.transition(ctx, Closed)
+		}
+	case Open:
+	}
+}
+
+// transition moves the breaker to state, logging and reporting the
+// transition. It must be called with the lock held.
+func (b *Breaker) transition(ctx context.Context, state State) {
+	from := b.state
+	b.state = state
+	b.gen++
+	b.failures = 0
+	b.successes = 0
+	b.probes = 0
+	if state == Open {
+		b.openedAt = time.Now()
+	}
+
+	appName := app.Info().Name
+	breakerState.WithLabelValues(appName, b.name).Set(float64(state))
+	breakerTransitions.WithLabelValues(appName, b.name, from.String(), state.String()).Inc()
+
+	log.Warn(ctx, "circuitbreaker state changed", log.F{
+		"circuitbreaker.name": b.name,
+		"circuitbreaker.from": from.String(),
+		"circuitbreaker.to":   state.String(),
+	})
+}
+
+// rejected returns the error for a rejected call.
+func (b *Breaker) rejected() error {
+	return orerr.New(fmt.Errorf("%s: %w", b.name, ErrOpen), orerr.WithStatus(statuscodes.Unavailable))
+}
+
+// IsFailure returns true if err counts toward opening a breaker: server
+// errors, including DeadlineExceeded and errors without a status code,
+// are failures. Client errors and canceled contexts are not.
+func IsFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	code := orerr.ExtractErrorStatusCode(err)
+	return code == statuscodes.DeadlineExceeded ||
+		orerr.ExtractErrorStatusCategory(err) == statuscodes.CategoryServerError
+}
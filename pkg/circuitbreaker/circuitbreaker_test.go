@@ -0,0 +1,152 @@
+package circuitbreaker_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/grevych/gobox/pkg/circuitbreaker"
+	"github.com/grevych/gobox/pkg/orerr"
+	"github.com/grevych/gobox/pkg/statuscodes"
+)
+
+var (
+	errServer = orerr.NewErrorStatus(errors.New("internal"), statuscodes.InternalServerError)
+	errClient = orerr.NewErrorStatus(errors.New("not found"), statuscodes.NotFound)
+)
+
+func call(b *circuitbreaker.Breaker, err error) error {
+	return b.Do(context.Background(), func(context.Context) error {
+		return err
+	})
+}
+
+func TestBreaker_OpensOnServerErrors(t *testing.T) {
+	b := circuitbreaker.New("test", circuitbreaker.WithFailureThreshold(3), circuitbreaker.WithOpenTimeout(time.Hour))
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, b.State(), circuitbreaker.Closed)
+		assert.Equal(t, call(b, errServer), errServer)
+	}
+	assert.Equal(t, b.State(), circuitbreaker.Open)
+
+	err := call(b, nil)
+	assert.Assert(t, errors.Is(err, circuitbreaker.ErrOpen))
+	assert.Equal(t, orerr.ExtractErrorStatusCode(err), statuscodes.Unavailable)
+	assert.ErrorContains(t, err, "test: circuit breaker is open")
+}
+
+func TestBreaker_IgnoresClientErrors(t *testing.T) {
+	b := circuitbreaker.New("test", circuitbreaker.WithFailureThreshold(2))
+
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, call(b, errClient), errClient)
+		assert.Equal(t, call(b, context.Canceled), context.Canceled)
+	}
+	assert.Equal(t, b.State(), circuitbreaker.Closed)
+
+	// successes reset the consecutive failures
+	assert.Equal(t, call(b, errServer), errServer)
+	assert.NilError(t, call(b, nil))
+	assert.Equal(t, call(b, errServer), errServer)
+	assert.Equal(t, b.State(), circuitbreaker.Closed)
+}
+
+func TestBreaker_HalfOpen(t *testing.T) {
+	b := circuitbreaker.New("test",
+		circuitbreaker.WithFailureThreshold(1),
+		circuitbreaker.WithOpenTimeout(10*time.Millisecond),
+		circuitbreaker.WithSuccessThreshold(2),
+	)
+	ctx := context.Background()
+
+	assert.Equal(t, call(b, errServer), errServer)
+	assert.Equal(t, b.State(), circuitbreaker.Open)
+
+	time.Sleep(15 * time.Millisecond)
+	assert.Equal(t, b.State(), circuitbreaker.HalfOpen)
+
+	// only one probe at a time
+	done, err := b.Allow(ctx)
+	assert.NilError(t, err)
+	_, err = b.Allow(ctx)
+	assert.Assert(t, errors.Is(err, circuitbreaker.ErrOpen))
+
+	done(ctx, nil)
+	assert.Equal(t, b.State(), circuitbreaker.HalfOpen)
+	assert.NilError(t, call(b, nil))
+	assert.Equal(t, b.State(), circuitbreaker.Closed)
+}
+
+func TestBreaker_HalfOpenFailureReopens(t *testing.T) {
+	b := circuitbreaker.New("test",
+		circuitbreaker.WithFailureThreshold(1),
+		circuitbreaker.WithOpenTimeout(10*time.Millisecond),
+	)
+
+	assert.Equal(t, call(b, errServer), errServer)
+	time.Sleep(15 * time.Millisecond)
+
+	deadline := fmt.Errorf("calling billing: %w", context.DeadlineExceeded)
+	assert.Equal(t, call(b, deadline), deadline)
+	assert.Equal(t, b.State(), circuitbreaker.Open)
+}
+
+func TestBreaker_HalfOpenIgnoresNeutralProbes(t *testing.T) {
+	b := circuitbreaker.New("test",
+		circuitbreaker.WithFailureThreshold(1),
+		circuitbreaker.WithOpenTimeout(10*time.Millisecond),
+	)
+
+	assert.Equal(t, call(b, errServer), errServer)
+	time.Sleep(15 * time.Millisecond)
+
+	// the probes are released, without closing the breaker
+	assert.Equal(t, call(b, errClient), errClient)
+	assert.Equal(t, b.State(), circuitbreaker.HalfOpen)
+	assert.Equal(t, call(b, context.Canceled), context.Canceled)
+	assert.Equal(t, b.State(), circuitbreaker.HalfOpen)
+
+	assert.NilError(t, call(b, nil))
+	assert.Equal(t, b.State(), circuitbreaker.Closed)
+}
+
+func TestBreaker_HalfOpenPanicReopens(t *testing.T) {
+	b := circuitbreaker.New("test",
+		circuitbreaker.WithFailureThreshold(1),
+		circuitbreaker.WithOpenTimeout(10*time.Millisecond),
+	)
+
+	assert.Equal(t, call(b, errServer), errServer)
+	time.Sleep(15 * time.Millisecond)
+
+	recovered := func() (recovered interface{}) {
+		defer func() { recovered = recover() }()
+		//nolint:errcheck // Why: panics
+		b.Do(context.Background(), func(context.Context) error {
+			panic("oh no")
+		})
+		return nil
+	}()
+	assert.Equal(t, recovered, "oh no")
+	assert.Equal(t, b.State(), circuitbreaker.Open)
+
+	// the probe was released, the next one closes the breaker
+	time.Sleep(15 * time.Millisecond)
+	assert.NilError(t, call(b, nil))
+	assert.Equal(t, b.State(), circuitbreaker.Closed)
+}
+
+func TestIsFailure(t *testing.T) {
+	assert.Assert(t, !circuitbreaker.IsFailure(nil))
+	assert.Assert(t, !circuitbreaker.IsFailure(errClient))
+	assert.Assert(t, !circuitbreaker.IsFailure(context.Canceled))
+	assert.Assert(t, circuitbreaker.IsFailure(errServer))
+	assert.Assert(t, circuitbreaker.IsFailure(errors.New("untagged")))
+	assert.Assert(t, circuitbreaker.IsFailure(context.DeadlineExceeded))
+	assert.Assert(t, circuitbreaker.IsFailure(orerr.NewErrorStatus(errors.New("slow"), statuscodes.DeadlineExceeded)))
+}
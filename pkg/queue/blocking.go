@@ -0,0 +1,161 @@
+// Copyright 2022 Outreach Corporation. All Rights Reserved.
+
+// Description: Provides a generic, blocking priority queue.
+
+package queue
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+)
+
+// NewBlockingPriorityQueue creates a new blocking priority queue. It accepts the same
+// options as NewPriorityQueue.
+func NewBlockingPriorityQueue[T any](opts ...PriorityQueueOption) *BlockingPriorityQueue[T] {
+	// resolve the options on a priority queue, to share them
+	cfg := NewPriorityQueue(opts...)
+	return &BlockingPriorityQueue[T]{
+		capacity: cfg.capacity,
+		queue:    cfg.queue,
+		pushed:   make(chan struct{}),
+		popped:   make(chan struct{}),
+	}
+}
+
+// BlockingPriorityQueue is a priority queue of T for producers and consumers. On top of
+// Push and Pop, PushWait waits for room in a queue at capacity and PopWait waits for an
+// item in an empty queue. Closing the queue wakes up all the waiters.
+type BlockingPriorityQueue[T any] struct {
+	lock     sync.Mutex
+	capacity uint
+	queue    *priorityQueueInternal
+	closed   bool
+
+	// pushed and popped are closed and replaced when an item is pushed or popped, to
+	// wake up the waiters.
+	pushed chan struct{}
+	popped chan struct{}
+}
+
+// Push an item into the queue. Push returns ErrFull if the queue is at capacity, and
+// ErrClosed if the queue is closed.
+func (q *BlockingPriorityQueue[T]) Push(data T, priority int64) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	_, err := q.push(data, priority)
+	return err
+}
+
+// PushWait pushes an item into the queue, waiting for room while the queue is at
+// capacity. PushWait returns ErrClosed if the queue is closed, and the context error if
+// the context ends first.
+func (q *BlockingPriorityQueue[T]) PushWait(ctx context.Context, data T, priority int64) error {
+	for {
+		q.lock.Lock()
+		popped, err := q.push(data, priority)
+		q.lock.Unlock()
+		if popped == nil {
+			return err
+		}
+
+		select {
+		case <-popped:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// push an item into the queue. push returns the channel closed on the next pop when the
+// queue is full.
+func (q *BlockingPriorityQueue[T]) push(data T, priority int64) (<-chan struct{}, error) {
+	if q.closed {
+		return nil, ErrClosed
+	}
+	if uint(q.queue.Len()) >= q.capacity {
+		return q.popped, ErrFull
+	}
+	heap.Push(q.queue, newPriorityQueueItem(data, priority))
+	close(q.pushed)
+	q.pushed = make(chan struct{})
+	return nil, nil
+}
+
+// Pop removes and returns the first item in the queue. Pop returns false if the queue is
+// empty.
+func (q *BlockingPriorityQueue[T]) Pop() (T, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	data, ok, _ := q.pop()
+	return data, ok
+}
+
+// PopWait removes and returns the first item in the queue, waiting for one while the
+// queue is empty. Once the queue is closed, PopWait keeps returning the remaining items,
+// then ErrClosed. PopWait returns the context error if the context ends first.
+func (q *BlockingPriorityQueue[T]) PopWait(ctx context.Context) (T, error) {
+	for {
+		q.lock.Lock()
+		data, ok, pushed := q.pop()
+		closed := q.closed
+		q.lock.Unlock()
+		if ok {
+			return data, nil
+		}
+		if closed {
+			return data, ErrClosed
+		}
+
+		select {
+		case <-pushed:
+		case <-ctx.Done():
+			return data, ctx.Err()
+		}
+	}
+}
+
+// pop removes and returns the first item in the queue. pop returns the channel closed on
+// the next push when the queue is empty.
+func (q *BlockingPriorityQueue[T]) pop() (data T, ok bool, pushed <-chan struct{}) {
+	if q.queue.Len() <= 0 {
+		return data, false, q.pushed
+	}
+	item := heap.Pop(q.queue).(*PriorityQueueItem)
+	if !q.closed {
+		close(q.popped)
+		q.popped = make(chan struct{})
+	}
+	return item.GetData().(T), true, nil
+}
+
+// Peek returns the first item in the queue without removing it. Peek returns false if
+// the queue is empty.
+func (q *BlockingPriorityQueue[T]) Peek() (data T, ok bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.queue.Len() <= 0 {
+		return data, false
+	}
+	return q.queue.Peek().GetData().(T), true
+}
+
+// Len returns the number of items in the queue.
+func (q *BlockingPriorityQueue[T]) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.queue.Len()
+}
+
+// Close closes the queue: pushes fail with ErrClosed and, once the remaining items are
+// popped, so does PopWait. Waiters are woken up. Closing a closed queue does nothing.
+func (q *BlockingPriorityQueue[T]) Close() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.closed {
+		return
+	}
+	q.closed = true
+	close(q.pushed)
+	close(q.popped)
+}
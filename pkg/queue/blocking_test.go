@@ -0,0 +1,124 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestBlockingPriorityQueue_Push_Pop(t *testing.T) {
+	queue := NewBlockingPriorityQueue[string](WithMaxHeap(), WithCapacity(3))
+	_, ok := queue.Pop()
+	assert.Assert(t, !ok)
+
+	assert.NilError(t, queue.Push("low", 1))
+	assert.NilError(t, queue.Push("high", 3))
+	assert.NilError(t, queue.Push("medium", 2))
+	assert.Equal(t, queue.Push("full", 4), ErrFull)
+	assert.Equal(t, queue.Len(), 3)
+
+	peek, ok := queue.Peek()
+	assert.Assert(t, ok)
+	assert.Equal(t, peek, "high")
+	for _, expected := range []string{"high", "medium", "low"} {
+		data, ok := queue.Pop()
+		assert.Assert(t, ok)
+		assert.Equal(t, data, expected)
+	}
+	_, ok = queue.Peek()
+	assert.Assert(t, !ok)
+}
+
+func TestBlockingPriorityQueue_PopWait(t *testing.T) {
+	queue := NewBlockingPriorityQueue[int]()
+	ctx := context.Background()
+
+	results := make(chan int)
+	for i := 0; i < 3; i++ {
+		go func() {
+			data, err := queue.PopWait(ctx)
+			assert.Check(t, err)
+			results <- data
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	sum := 0
+	for i := 1; i <= 3; i++ {
+		assert.NilError(t, queue.Push(i, int64(i)))
+		sum += <-results
+	}
+	assert.Equal(t, sum, 6)
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err := queue.PopWait(timeout)
+	assert.Assert(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestBlockingPriorityQueue_PushWait(t *testing.T) {
+	queue := NewBlockingPriorityQueue[int](WithCapacity(1))
+	ctx := context.Background()
+	assert.NilError(t, queue.Push(1, 1))
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.Assert(t, errors.Is(queue.PushWait(timeout, 2, 2), context.DeadlineExceeded))
+
+	pushed := make(chan error)
+	go func() {
+		pushed <- queue.PushWait(ctx, 2, 2)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	data, err := queue.PopWait(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, data, 1)
+	assert.NilError(t, <-pushed)
+
+	data, err = queue.PopWait(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, data, 2)
+}
+
+func TestBlockingPriorityQueue_Close(t *testing.T) {
+	queue := NewBlockingPriorityQueue[int](WithCapacity(1))
+	ctx := context.Background()
+	assert.NilError(t, queue.Push(1, 1))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.Check(t, queue.PushWait(ctx, 2, 2) == ErrClosed)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	queue.Close()
+	queue.Close()
+	wg.Wait()
+	assert.Equal(t, queue.Push(3, 3), ErrClosed)
+
+	// the remaining items are still popped
+	data, err := queue.PopWait(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, data, 1)
+	_, err = queue.PopWait(ctx)
+	assert.Equal(t, err, ErrClosed)
+
+	// waiters on an empty queue are woken up
+	empty := NewBlockingPriorityQueue[int]()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := empty.PopWait(ctx)
+		assert.Check(t, err == ErrClosed)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	empty.Close()
+	wg.Wait()
+}
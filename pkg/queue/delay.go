@@ -0,0 +1,220 @@
+// Copyright 2022 Outreach Corporation. All Rights Reserved.
+
+// Description: Provides a delay queue.
+
+package queue
+
+import (
+	"container/heap"
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// NewDelayQueue creates a new delay queue. Only the WithCapacity option applies, items
+// are always ordered by the time they become visible.
+func NewDelayQueue[T any](opts ...PriorityQueueOption) *DelayQueue[T] {
+	// resolve the options on a priority queue, to share them
+	cfg := NewPriorityQueue(opts...)
+	return &DelayQueue[T]{
+		capacity: cfg.capacity,
+		queue:    newPriorityQueueInternal(true),
+		changed:  make(chan struct{}),
+	}
+}
+
+// DelayQueue is a queue of T whose items become visible at a given time, for delayed jobs
+// and retries. Items are kept in a min heap keyed by that time. Pending items can be
+// rescheduled with Update and canceled with Remove.
+type DelayQueue[T any] struct {
+	lock     sync.Mutex
+	capacity uint
+	queue    *priorityQueueInternal
+	closed   bool
+
+	// changed is closed and replaced when the first item may have changed, to wake up
+	// the waiters.
+	changed chan struct{}
+}
+
+// DelayQueueItem represents an item in a delay queue.
+type DelayQueueItem[T any] struct {
+	item *PriorityQueueItem
+}
+
+// GetData returns the data.
+func (i *DelayQueueItem[T]) GetData() T {
+	return i.item.GetData().(T)
+}
+
+// GetVisibleAt returns the time the item becomes visible.
+func (i *DelayQueueItem[T]) GetVisibleAt() time.Time {
+	return time.Unix(0, i.item.GetPriority())
+}
+
+// Push an item into the queue, visible at the given time. Push returns a DelayQueueItem
+// that can be used to reschedule or remove the item. Push returns ErrFull if the queue is
+// at capacity, and ErrClosed if the queue is closed.
+//
+// A zero time makes the item visible now. Times out of the range of UnixNano, about the
+// years 1678 to 2262, are clamped to it.
+func (q *DelayQueue[T]) Push(data T, at time.Time) (*DelayQueueItem[T], error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.closed {
+		return nil, ErrClosed
+	}
+	if uint(q.queue.Len()) >= q.capacity {
+		return nil, ErrFull
+	}
+	item := newPriorityQueueItem(data, unixNano(at))
+	heap.Push(q.queue, item)
+	q.notify()
+	return &DelayQueueItem[T]{item: item}, nil
+}
+
+// PushAfter pushes an item into the queue, visible after the given delay.
+func (q *DelayQueue[T]) PushAfter(data T, d time.Duration) (*DelayQueueItem[T], error) {
+	return q.Push(data, time.Now().Add(d))
+}
+
+// Pop removes and returns the first visible item in the queue. Pop returns false if no
+// item is visible yet.
+func (q *DelayQueue[T]) Pop() (T, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	data, _, ok := q.pop(time.Now())
+	return data, ok
+}
+
+// PopWait removes and returns the first item in the queue, waiting until it becomes
+// visible. Items pushed, rescheduled or removed while waiting are taken into account.
+// PopWait returns ErrClosed once the queue is closed, and the context error if the
+// context ends first.
+func (q *DelayQueue[T]) PopWait(ctx context.Context) (T, error) {
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		q.lock.Lock()
+		data, wait, ok := q.pop(time.Now())
+		changed, closed := q.changed, q.closed
+		q.lock.Unlock()
+		if closed {
+			var zero T
+			return zero, ErrClosed
+		}
+		if ok {
+			return data, nil
+		}
+
+		// wait for the first item, or for a change to the queue
+		var visible <-chan time.Time
+		if wait > 0 {
+			if timer == nil {
+				timer = time.NewTimer(wait)
+			} else {
+				timer.Reset(wait)
+			}
+			visible = timer.C
+		}
+
+		select {
+		case <-visible:
+		case <-changed:
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		}
+	}
+}
+
+// pop removes and returns the first item in the queue if it is visible at now. Otherwise
+// pop returns how long until it is, or zero if the queue is empty.
+func (q *DelayQueue[T]) pop(now time.Time) (data T, wait time.Duration, ok bool) {
+	if q.queue.Len() <= 0 {
+		return data, 0, false
+	}
+	if wait := time.Unix(0, q.queue.Peek().GetPriority()).Sub(now); wait > 0 {
+		return data, wait, false
+	}
+	item := heap.Pop(q.queue).(*PriorityQueueItem)
+	return item.GetData().(T), 0, true
+}
+
+// Update reschedules an item in the queue to become visible at the given time, handled
+// like the time of Push. Return error if the item is not in the queue.
+func (q *DelayQueue[T]) Update(item *DelayQueueItem[T], at time.Time) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if item == nil || !q.queue.Contains(item.item) {
+		return ErrNotInQueue
+	}
+	item.item.SetPriority(unixNano(at))
+	heap.Fix(q.queue, item.item.getIndex())
+	q.notify()
+	return nil
+}
+
+// Remove an item from the queue, canceling it. Remove returns false if the item is not in
+// the queue, for example because it was already popped.
+func (q *DelayQueue[T]) Remove(item *DelayQueueItem[T]) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if item == nil || !q.queue.Contains(item.item) {
+		return false
+	}
+	index := item.item.getIndex()
+	q.queue.Remove(index)
+	// Fix the index if removed item is not the last one.
+	if index < q.queue.Len() {
+		heap.Fix(q.queue, index)
+	}
+	q.notify()
+	return true
+}
+
+// unixNano returns the time an item is visible at, in nanoseconds since the epoch. The
+// zero time is now, and other times are clamped to the range of UnixNano.
+func unixNano(at time.Time) int64 {
+	switch {
+	case at.IsZero():
+		return time.Now().UnixNano()
+	case at.Before(time.Unix(0, math.MinInt64)):
+		return math.MinInt64
+	case at.After(time.Unix(0, math.MaxInt64)):
+		return math.MaxInt64
+	}
+	return at.UnixNano()
+}
+
+// Len returns the number of items in the queue, visible or not.
+func (q *DelayQueue[T]) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.queue.Len()
+}
+
+// Close closes the queue: pushes fail with ErrClosed and waiters are woken up with
+// ErrClosed. Pending items are dropped. Closing a closed queue does nothing.
+func (q *DelayQueue[T]) Close() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.closed {
+		return
+	}
+	q.closed = true
+	q.queue.Clear()
+	close(q.changed)
+}
+
+// notify wakes up the waiters.
+func (q *DelayQueue[T]) notify() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
@@ -0,0 +1,155 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestDelayQueue_Pop(t *testing.T) {
+	queue := NewDelayQueue[string](WithCapacity(3))
+	now := time.Now()
+
+	_, err := queue.Push("past", now.Add(-time.Second))
+	assert.NilError(t, err)
+	later, err := queue.Push("later", now.Add(time.Hour))
+	assert.NilError(t, err)
+	_, err = queue.Push("earlier", now.Add(-time.Minute))
+	assert.NilError(t, err)
+	_, err = queue.Push("full", now)
+	assert.Equal(t, err, ErrFull)
+	assert.Equal(t, later.GetData(), "later")
+	assert.Assert(t, later.GetVisibleAt().Equal(now.Add(time.Hour)))
+
+	for _, expected := range []string{"earlier", "past"} {
+		data, ok := queue.Pop()
+		assert.Assert(t, ok)
+		assert.Equal(t, data, expected)
+	}
+	_, ok := queue.Pop()
+	assert.Assert(t, !ok, "item popped before it is visible")
+	assert.Equal(t, queue.Len(), 1)
+}
+
+func TestDelayQueue_PushTimes(t *testing.T) {
+	queue := NewDelayQueue[string]()
+	now := time.Now()
+
+	never, err := queue.Push("never", time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.NilError(t, err)
+	assert.Assert(t, never.GetVisibleAt().Equal(time.Unix(0, math.MaxInt64)))
+	ancient, err := queue.Push("ancient", time.Date(1000, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.NilError(t, err)
+	assert.Assert(t, ancient.GetVisibleAt().Equal(time.Unix(0, math.MinInt64)))
+	zero, err := queue.Push("zero", time.Time{})
+	assert.NilError(t, err)
+	assert.Assert(t, !zero.GetVisibleAt().Before(now))
+
+	for _, expected := range []string{"ancient", "zero"} {
+		data, ok := queue.Pop()
+		assert.Assert(t, ok)
+		assert.Equal(t, data, expected)
+	}
+	_, ok := queue.Pop()
+	assert.Assert(t, !ok, "item popped before it is visible")
+
+	// so does Update
+	assert.NilError(t, queue.Update(never, time.Time{}))
+	data, ok := queue.Pop()
+	assert.Assert(t, ok)
+	assert.Equal(t, data, "never")
+}
+
+func TestDelayQueue_PopWait(t *testing.T) {
+	queue := NewDelayQueue[int]()
+	ctx := context.Background()
+
+	start := time.Now()
+	_, err := queue.PushAfter(2, 40*time.Millisecond)
+	assert.NilError(t, err)
+	_, err = queue.PushAfter(1, 20*time.Millisecond)
+	assert.NilError(t, err)
+
+	data, err := queue.PopWait(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, data, 1)
+	assert.Assert(t, time.Since(start) >= 20*time.Millisecond)
+
+	data, err = queue.PopWait(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, data, 2)
+	assert.Assert(t, time.Since(start) >= 40*time.Millisecond)
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = queue.PopWait(timeout)
+	assert.Assert(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestDelayQueue_PopWaitSeesChanges(t *testing.T) {
+	queue := NewDelayQueue[string]()
+	ctx := context.Background()
+
+	results := make(chan string)
+	go func() {
+		data, err := queue.PopWait(ctx)
+		assert.Check(t, err)
+		results <- data
+	}()
+
+	// an item pushed while waiting on an empty queue
+	slow, err := queue.PushAfter("slow", time.Hour)
+	assert.NilError(t, err)
+	time.Sleep(10 * time.Millisecond)
+
+	// an item moved earlier while waiting on a later one
+	assert.NilError(t, queue.Update(slow, time.Now().Add(10*time.Millisecond)))
+	select {
+	case data := <-results:
+		assert.Equal(t, data, "slow")
+	case <-time.After(time.Second):
+		t.Fatal("rescheduled item was not popped")
+	}
+	assert.Equal(t, queue.Update(slow, time.Now()), ErrNotInQueue)
+}
+
+func TestDelayQueue_Remove(t *testing.T) {
+	queue := NewDelayQueue[string]()
+
+	canceled, err := queue.PushAfter("canceled", 0)
+	assert.NilError(t, err)
+	_, err = queue.PushAfter("kept", 0)
+	assert.NilError(t, err)
+
+	assert.Assert(t, queue.Remove(canceled))
+	assert.Assert(t, !queue.Remove(canceled))
+
+	data, ok := queue.Pop()
+	assert.Assert(t, ok)
+	assert.Equal(t, data, "kept")
+	assert.Equal(t, queue.Len(), 0)
+}
+
+func TestDelayQueue_Close(t *testing.T) {
+	queue := NewDelayQueue[int]()
+	_, err := queue.PushAfter(1, time.Hour)
+	assert.NilError(t, err)
+
+	errs := make(chan error)
+	go func() {
+		_, err := queue.PopWait(context.Background())
+		errs <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	queue.Close()
+	queue.Close()
+	assert.Equal(t, <-errs, ErrClosed)
+	assert.Equal(t, queue.Len(), 0)
+	_, err = queue.PushAfter(2, 0)
+	assert.Equal(t, err, ErrClosed)
+}
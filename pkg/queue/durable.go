@@ -0,0 +1,686 @@
+// Copyright 2022 Outreach Corporation. All Rights Reserved.
+
+// Description: Provides a durable priority queue backed by a write-ahead log.
+
+package queue
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// This section defines durable queue default configuration.
+const (
+	// DefaultDurableQueueSegmentSize is the default size, in bytes, at which a segment of
+	// the log is rotated.
+	DefaultDurableQueueSegmentSize = 64 << 20
+
+	// DefaultDurableQueueSyncInterval is the default interval between two fsyncs with
+	// SyncInterval.
+	DefaultDurableQueueSyncInterval = time.Second
+
+	// DefaultDurableQueueCompactionRatio is the default ratio of dead records in the log
+	// above which the log is compacted when a segment is rotated.
+	DefaultDurableQueueCompactionRatio = 0.5
+)
+
+// ErrCorrupted is returned when opening a durable queue whose log has a corrupted record
+// other than a torn write at its end.
+var ErrCorrupted = errors.New("queue log is corrupted")
+
+// errChecksum is the error of a record whose checksum does not match its payload.
+var errChecksum = errors.New("checksum mismatch")
+
+// SyncPolicy defines when a durable queue fsyncs its log.
+type SyncPolicy int
+
+// This section defines the sync policies.
+const (
+	// SyncAlways fsyncs the log before Push and Pop return. No acknowledged push or pop is
+	// lost on a crash. This is the default.
+	SyncAlways SyncPolicy = iota
+
+	// SyncInterval fsyncs the log periodically, see WithSyncInterval. Pushes and pops
+	// acknowledged during the last interval can be lost on a crash of the node.
+	SyncInterval
+
+	// SyncNever leaves flushing the log to the operating system.
+	SyncNever
+)
+
+// DurableQueueOption is used to change durable queue default configuration.
+type DurableQueueOption func(q *durableQueueConfig)
+
+// durableQueueConfig holds the configuration of a durable queue.
+type durableQueueConfig struct {
+	segmentSize     int64
+	sync            SyncPolicy
+	syncInterval    time.Duration
+	compactionRatio float64
+	queueOptions    []PriorityQueueOption
+}
+
+// WithSegmentSize sets the size, in bytes, at which a segment of the log is rotated.
+func WithSegmentSize(v int64) DurableQueueOption {
+	return func(q *durableQueueConfig) {
+		q.segmentSize = v
+	}
+}
+
+// WithSyncPolicy sets when the log is fsynced.
+func WithSyncPolicy(v SyncPolicy) DurableQueueOption {
+	return func(q *durableQueueConfig) {
+		q.sync = v
+	}
+}
+
+// WithSyncInterval makes the queue fsync the log at the given interval, see SyncInterval.
+func WithSyncInterval(v time.Duration) DurableQueueOption {
+	return func(q *durableQueueConfig) {
+		q.sync = SyncInterval
+		q.syncInterval = v
+	}
+}
+
+// WithCompactionRatio sets the ratio of dead records, pushes of popped items and pops, in
+// the log above which the log is compacted when a segment is rotated. A ratio of zero or
+// less disables compaction, except by Compact.
+func WithCompactionRatio(v float64) DurableQueueOption {
+	return func(q *durableQueueConfig) {
+		q.compactionRatio = v
+	}
+}
+
+// WithPriorityQueueOptions sets the options of the in-memory priority queue of a durable
+// queue, such as the capacity or the heap type.
+func WithPriorityQueueOptions(opts ...PriorityQueueOption) DurableQueueOption {
+	return func(q *durableQueueConfig) {
+		q.queueOptions = opts
+	}
+}
+
+// DurableQueue is a priority queue of T persisted in an append-only log of segment files
+// in a directory, for producers and consumers of a single node. Items are encoded as
+// JSON. Every push and pop is appended to the log with a checksum, so that opening the
+// queue again after a restart or a crash recovers the items that were not popped.
+//
+// Popping an item removes it from the log: an item popped but not processed before a
+// crash is lost.
+type DurableQueue[T any] struct {
+	lock     sync.Mutex
+	cfg      durableQueueConfig
+	dir      string
+	capacity uint
+	queue    *priorityQueueInternal
+	closed   bool
+
+	// pushed is closed and replaced when an item is pushed, to wake up the waiters.
+	pushed chan struct{}
+
+	// segments holds the sequence numbers of the segments of the log, oldest first. The
+	// last one is active, appended to, and its size is size.
+	segments []uint64
+	active   *os.File
+	size     int64
+
+	// records is the number of records in the log, lastID the id of the last pushed item
+	// and dirty is true when the log has writes not fsynced yet.
+	records int
+	lastID  uint64
+	dirty   bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// durableData is the data of an item in a durable queue.
+type durableData[T any] struct {
+	id   uint64
+	raw  []byte
+	data T
+}
+
+// This section defines the records of the log. A record is framed by the length of its
+// payload and the CRC-32C of its payload.
+const (
+	// recordPush is the record of a pushed item: id, priority, push time and data.
+	recordPush byte = iota + 1
+
+	// recordPop is the record of a popped item: id.
+	recordPop
+
+	// recordHeaderSize is the size of the frame of a record.
+	recordHeaderSize = 8
+
+	// segmentExt is the extension of the segment files.
+	segmentExt = ".wal"
+)
+
+// crcTable is the CRC-32C table of the records checksums.
+var crcTable = crc32.MakeTable(crc32.Castagnoli) // nolint:gochecknoglobals // Why: computed once
+
+// OpenDurableQueue opens the durable queue in the given directory, creating it if needed,
+// and recovers its items. A record cut short or failing its checksum at the very end of
+// the last segment is a write interrupted by a crash, and is truncated. OpenDurableQueue
+// returns ErrCorrupted if any other record cannot be read, rather than dropping the
+// records after it.
+//
+// All the items of the log are recovered, even beyond the capacity of the queue, for
+// example after the capacity was lowered: Push then returns ErrFull until enough items
+// are popped.
+func OpenDurableQueue[T any](dir string, opts ...DurableQueueOption) (*DurableQueue[T], error) {
+	cfg := durableQueueConfig{
+		segmentSize:     DefaultDurableQueueSegmentSize,
+		sync:            SyncAlways,
+		syncInterval:    DefaultDurableQueueSyncInterval,
+		compactionRatio: DefaultDurableQueueCompactionRatio,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	// resolve the options of the in-memory queue on a priority queue, to share them
+	pq := NewPriorityQueue(cfg.queueOptions...)
+
+	q := &DurableQueue[T]{
+		cfg:      cfg,
+		dir:      dir,
+		capacity: pq.capacity,
+		queue:    pq.queue,
+		pushed:   make(chan struct{}),
+	}
+	if err := q.recover(); err != nil {
+		return nil, err
+	}
+
+	if cfg.sync == SyncInterval {
+		q.stop = make(chan struct{})
+		q.done = make(chan struct{})
+		go q.syncLoop()
+	}
+	return q, nil
+}
+
+// recover replays the segments of the log into the queue and opens the last segment.
+func (q *DurableQueue[T]) recover() error {
+	if err := os.MkdirAll(q.dir, 0o755); err != nil {
+		return errors.Wrapf(err, "failed to create queue directory %q", q.dir)
+	}
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to list queue directory %q", q.dir)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		// a temporary segment is a compaction interrupted by a crash
+		if strings.HasSuffix(name, segmentExt+".tmp") {
+			if err := os.Remove(filepath.Join(q.dir, name)); err != nil {
+				return errors.Wrapf(err, "failed to remove temporary segment %q", name)
+			}
+			continue
+		}
+		if seq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64); err == nil && strings.HasSuffix(name, segmentExt) {
+			q.segments = append(q.segments, seq)
+		}
+	}
+	sort.Slice(q.segments, func(i, j int) bool { return q.segments[i] < q.segments[j] })
+	if len(q.segments) == 0 {
+		q.segments = []uint64{1}
+	}
+
+	live := map[uint64]*PriorityQueueItem{}
+	for i, seq := range q.segments {
+		last := i == len(q.segments)-1
+		if err := q.replay(seq, last, live); err != nil {
+			return err
+		}
+	}
+	for _, item := range live {
+		heap.Push(q.queue, item)
+	}
+
+	f, err := os.OpenFile(q.segmentPath(q.segments[len(q.segments)-1]), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "failed to open queue segment")
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close() // nolint:errcheck // Why: the stat error is returned
+		return errors.Wrap(err, "failed to stat queue segment")
+	}
+	q.active, q.size = f, info.Size()
+	return nil
+}
+
+// replay applies the records of a segment to the live items. The last segment is
+// truncated before a torn record at its end.
+func (q *DurableQueue[T]) replay(seq uint64, last bool, live map[uint64]*PriorityQueueItem) error {
+	path := q.segmentPath(seq)
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) && last {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to open queue segment %q", path)
+	}
+	defer f.Close() // nolint:errcheck // Why: read only
+
+	info, err := f.Stat()
+	if err != nil {
+		return errors.Wrapf(err, "failed to stat queue segment %q", path)
+	}
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for offset < info.Size() {
+		payload, err := readRecord(r, info.Size()-offset)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, errChecksum) {
+			return errors.Wrapf(err, "failed to read queue segment %q", path)
+		}
+		end := offset + int64(recordHeaderSize+len(payload))
+		// only the last record can be torn: it is cut short, or was not entirely flushed
+		torn := errors.Is(err, io.ErrUnexpectedEOF) || (errors.Is(err, errChecksum) && end == info.Size())
+		if err == nil {
+			err = q.apply(payload, live)
+		}
+		if err != nil {
+			if !last || !torn {
+				return errors.Wrapf(ErrCorrupted, "segment %q at offset %d: %v", path, offset, err)
+			}
+			if err := os.Truncate(path, offset); err != nil {
+				return errors.Wrapf(err, "failed to truncate queue segment %q", path)
+			}
+			return nil
+		}
+		offset = end
+	}
+	return nil
+}
+
+// readRecord reads the payload of the next record and verifies its checksum. remaining is
+// the number of bytes left in the segment. readRecord returns io.ErrUnexpectedEOF if the
+// record is cut short, and errChecksum with the payload if the checksum does not match.
+func readRecord(r io.Reader, remaining int64) ([]byte, error) {
+	var header [recordHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, shortRead(err)
+	}
+	n := binary.BigEndian.Uint32(header[0:4])
+	if int64(n) > remaining-recordHeaderSize {
+		return nil, io.ErrUnexpectedEOF
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, shortRead(err)
+	}
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[4:8]) {
+		return payload, errChecksum
+	}
+	return payload, nil
+}
+
+// shortRead returns io.ErrUnexpectedEOF for a read that hit the end of the segment, and
+// other errors as is.
+func shortRead(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// apply applies the payload of a record to the live items.
+func (q *DurableQueue[T]) apply(payload []byte, live map[uint64]*PriorityQueueItem) error {
+	if len(payload) < 9 {
+		return errors.New("record too short")
+	}
+	op, id := payload[0], binary.BigEndian.Uint64(payload[1:9])
+	switch op {
+	case recordPush:
+		if len(payload) < 25 {
+			return errors.New("push record too short")
+		}
+		raw := payload[25:]
+		var data T
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return errors.Wrap(err, "failed to decode item")
+		}
+		item := newPriorityQueueItem(durableData[T]{id: id, raw: raw, data: data}, int64(binary.BigEndian.Uint64(payload[9:17])))
+		item.pushedAt = time.Unix(0, int64(binary.BigEndian.Uint64(payload[17:25])))
+		live[id] = item
+		q.lastID = max(q.lastID, id)
+	case recordPop:
+		delete(live, id)
+	default:
+		return fmt.Errorf("unknown record type %d", op)
+	}
+	q.records++
+	return nil
+}
+
+// segmentPath returns the path of a segment.
+func (q *DurableQueue[T]) segmentPath(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seq, segmentExt))
+}
+
+// encodeRecord frames the payload of a record.
+func encodeRecord(payload []byte) []byte {
+	record := make([]byte, recordHeaderSize, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.Checksum(payload, crcTable))
+	return append(record, payload...)
+}
+
+// pushRecord returns the record of a pushed item.
+func pushRecord(item *PriorityQueueItem, id uint64, raw []byte) []byte {
+	payload := make([]byte, 25, 25+len(raw))
+	payload[0] = recordPush
+	binary.BigEndian.PutUint64(payload[1:9], id)
+	binary.BigEndian.PutUint64(payload[9:17], uint64(item.GetPriority()))
+	binary.BigEndian.PutUint64(payload[17:25], uint64(item.pushedAt.UnixNano()))
+	return encodeRecord(append(payload, raw...))
+}
+
+// popRecord returns the record of a popped item.
+func popRecord(id uint64) []byte {
+	payload := make([]byte, 9)
+	payload[0] = recordPop
+	binary.BigEndian.PutUint64(payload[1:9], id)
+	return encodeRecord(payload)
+}
+
+// append appends a record to the log, rotating or compacting it first if the active
+// segment is full.
+func (q *DurableQueue[T]) append(record []byte) error {
+	if q.size > 0 && q.size+int64(len(record)) > q.cfg.segmentSize {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+	}
+	if _, err := q.active.Write(record); err != nil {
+		// drop the partial record, so that the next records follow a valid one
+		q.active.Truncate(q.size) // nolint:errcheck // Why: the write error is returned
+		return errors.Wrap(err, "failed to write queue record")
+	}
+	q.size += int64(len(record))
+	q.records++
+	q.dirty = true
+	if q.cfg.sync == SyncAlways {
+		return q.sync()
+	}
+	return nil
+}
+
+// rotate compacts the log if it has enough dead records, or starts a new segment.
+func (q *DurableQueue[T]) rotate() error {
+	if q.cfg.compactionRatio > 0 && float64(q.records-q.queue.Len()) >= q.cfg.compactionRatio*float64(q.records) {
+		return q.compact()
+	}
+	if err := q.sync(); err != nil {
+		return err
+	}
+	seq := q.segments[len(q.segments)-1] + 1
+	f, err := os.OpenFile(q.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "failed to create queue segment")
+	}
+	if err := q.active.Close(); err != nil {
+		f.Close() // nolint:errcheck // Why: the close error is returned
+		return errors.Wrap(err, "failed to close queue segment")
+	}
+	q.segments = append(q.segments, seq)
+	q.active, q.size = f, 0
+	return nil
+}
+
+// compact writes the live items to a new segment and removes the previous segments. A
+// crash before the new segment is renamed leaves the log unchanged. A crash while removing
+// the previous segments leaves a suffix of them, whose pushes of live items are pushed
+// again by the new segment with the same ids.
+func (q *DurableQueue[T]) compact() error {
+	seq := q.segments[len(q.segments)-1] + 1
+	path := q.segmentPath(seq)
+	f, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "failed to create queue segment")
+	}
+
+	w := bufio.NewWriter(f)
+	var size int64
+	for _, item := range q.queue.items {
+		d := item.GetData().(durableData[T])
+		n, err := w.Write(pushRecord(item, d.id, d.raw))
+		if err != nil {
+			f.Close() // nolint:errcheck // Why: the write error is returned
+			return errors.Wrap(err, "failed to write queue segment")
+		}
+		size += int64(n)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close() // nolint:errcheck // Why: the write error is returned
+		return errors.Wrap(err, "failed to write queue segment")
+	}
+	if err := f.Sync(); err != nil {
+		f.Close() // nolint:errcheck // Why: the sync error is returned
+		return errors.Wrap(err, "failed to sync queue segment")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "failed to close queue segment")
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return errors.Wrap(err, "failed to rename queue segment")
+	}
+	if err := syncDir(q.dir); err != nil {
+		return err
+	}
+
+	active, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "failed to open queue segment")
+	}
+	q.active.Close() // nolint:errcheck // Why: the compacted segment replaces it
+	// remove the previous segments oldest first, see above
+	for _, old := range q.segments {
+		if err := os.Remove(q.segmentPath(old)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			active.Close() // nolint:errcheck // Why: the remove error is returned
+			return errors.Wrap(err, "failed to remove queue segment")
+		}
+	}
+	q.segments = []uint64{seq}
+	q.active, q.size = active, size
+	q.records = q.queue.Len()
+	q.dirty = false
+	return nil
+}
+
+// syncDir fsyncs a directory, to persist the creation and renaming of its files.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to open queue directory")
+	}
+	defer d.Close() // nolint:errcheck // Why: read only
+	return errors.Wrap(d.Sync(), "failed to sync queue directory")
+}
+
+// sync fsyncs the active segment if it has writes not fsynced yet.
+func (q *DurableQueue[T]) sync() error {
+	if !q.dirty {
+		return nil
+	}
+	if err := q.active.Sync(); err != nil {
+		return errors.Wrap(err, "failed to sync queue segment")
+	}
+	q.dirty = false
+	return nil
+}
+
+// syncLoop fsyncs the log at the sync interval until the queue is closed.
+func (q *DurableQueue[T]) syncLoop() {
+	defer close(q.done)
+	ticker := time.NewTicker(q.cfg.syncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			q.lock.Lock()
+			q.sync() // nolint:errcheck // Why: retried on the next tick and by Close
+			q.lock.Unlock()
+		case <-q.stop:
+			return
+		}
+	}
+}
+
+// Push an item into the queue and appends it to the log. Push returns ErrFull if the queue
+// is at capacity, and ErrClosed if the queue is closed.
+func (q *DurableQueue[T]) Push(data T, priority int64) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode item")
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	if uint(q.queue.Len()) >= q.capacity {
+		return ErrFull
+	}
+
+	id := q.lastID + 1
+	item := newPriorityQueueItem(durableData[T]{id: id, raw: raw, data: data}, priority)
+	if err := q.append(pushRecord(item, id, raw)); err != nil {
+		return err
+	}
+	q.lastID = id
+	heap.Push(q.queue, item)
+	close(q.pushed)
+	q.pushed = make(chan struct{})
+	return nil
+}
+
+// Pop removes the first item in the queue from the log and returns it. Pop returns false
+// if the queue is empty, and ErrClosed if the queue is closed.
+func (q *DurableQueue[T]) Pop() (data T, ok bool, err error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	data, ok, _, err = q.pop()
+	return data, ok, err
+}
+
+// PopWait removes the first item in the queue from the log and returns it, waiting for
+// one while the queue is empty. PopWait returns ErrClosed if the queue is closed, and the
+// context error if the context ends first.
+func (q *DurableQueue[T]) PopWait(ctx context.Context) (T, error) {
+	for {
+		q.lock.Lock()
+		data, ok, pushed, err := q.pop()
+		q.lock.Unlock()
+		if ok || err != nil {
+			return data, err
+		}
+
+		select {
+		case <-pushed:
+		case <-ctx.Done():
+			return data, ctx.Err()
+		}
+	}
+}
+
+// pop removes the first item in the queue from the log and returns it. pop returns the
+// channel closed on the next push when the queue is empty.
+func (q *DurableQueue[T]) pop() (data T, ok bool, pushed <-chan struct{}, err error) {
+	if q.closed {
+		return data, false, nil, ErrClosed
+	}
+	if q.queue.Len() <= 0 {
+		return data, false, q.pushed, nil
+	}
+	d := q.queue.Peek().GetData().(durableData[T])
+	if err := q.append(popRecord(d.id)); err != nil {
+		return data, false, nil, err
+	}
+	heap.Pop(q.queue)
+	return d.data, true, nil, nil
+}
+
+// Peek returns the first item in the queue without removing it. Peek returns false if the
+// queue is empty.
+func (q *DurableQueue[T]) Peek() (data T, ok bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.queue.Len() <= 0 {
+		return data, false
+	}
+	return q.queue.Peek().GetData().(durableData[T]).data, true
+}
+
+// Len returns the number of items in the queue.
+func (q *DurableQueue[T]) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.queue.Len()
+}
+
+// Compact rewrites the log with only the items in the queue.
+func (q *DurableQueue[T]) Compact() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	return q.compact()
+}
+
+// Sync fsyncs the log, whatever the sync policy.
+func (q *DurableQueue[T]) Sync() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	return q.sync()
+}
+
+// Close fsyncs and closes the log. The items in the queue stay in the log, for the next
+// OpenDurableQueue. Pushes and pops fail with ErrClosed, and the waiters are woken up.
+// Closing a closed queue does nothing.
+func (q *DurableQueue[T]) Close() error {
+	q.lock.Lock()
+	if q.closed {
+		q.lock.Unlock()
+		return nil
+	}
+	q.closed = true
+	close(q.pushed)
+	q.lock.Unlock()
+
+	if q.stop != nil {
+		close(q.stop)
+		<-q.done
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	err := q.sync()
+	if cerr := q.active.Close(); err == nil && cerr != nil {
+		err = errors.Wrap(cerr, "failed to close queue segment")
+	}
+	return err
+}
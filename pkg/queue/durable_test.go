@@ -0,0 +1,225 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+// popAllDurable pops all the items of a durable queue.
+func popAllDurable(t *testing.T, queue *DurableQueue[string]) []string {
+	popped := []string{}
+	for {
+		data, ok, err := queue.Pop()
+		assert.NilError(t, err)
+		if !ok {
+			return popped
+		}
+		popped = append(popped, data)
+	}
+}
+
+// segmentFiles returns the segment files of a durable queue.
+func segmentFiles(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	assert.NilError(t, err)
+	return files
+}
+
+func TestDurableQueue_Recover(t *testing.T) {
+	dir := t.TempDir()
+	queue, err := OpenDurableQueue[string](dir, WithPriorityQueueOptions(WithCapacity(3)))
+	assert.NilError(t, err)
+
+	for i, data := range []string{"c", "a", "b"} {
+		assert.NilError(t, queue.Push(data, int64(i)))
+	}
+	assert.Equal(t, queue.Push("d", 0), ErrFull)
+	data, ok, err := queue.Pop()
+	assert.NilError(t, err)
+	assert.Assert(t, ok)
+	assert.Equal(t, data, "c")
+	assert.NilError(t, queue.Close())
+	assert.NilError(t, queue.Close())
+
+	_, _, err = queue.Pop()
+	assert.Equal(t, err, ErrClosed)
+	assert.Equal(t, queue.Push("d", 0), ErrClosed)
+
+	queue, err = OpenDurableQueue[string](dir)
+	assert.NilError(t, err)
+	defer queue.Close()
+	assert.Equal(t, queue.Len(), 2)
+	assert.NilError(t, queue.Push("d", 0))
+	peeked, ok := queue.Peek()
+	assert.Assert(t, ok)
+	assert.Equal(t, peeked, "d")
+	assert.DeepEqual(t, popAllDurable(t, queue), []string{"d", "a", "b"})
+}
+
+func TestDurableQueue_TornWrite(t *testing.T) {
+	dir := t.TempDir()
+	queue, err := OpenDurableQueue[string](dir)
+	assert.NilError(t, err)
+	assert.NilError(t, queue.Push("a", 1))
+	assert.NilError(t, queue.Push("b", 2))
+	assert.NilError(t, queue.Close())
+
+	// a crash in the middle of the last record
+	segment := segmentFiles(t, dir)[0]
+	info, err := os.Stat(segment)
+	assert.NilError(t, err)
+	assert.NilError(t, os.Truncate(segment, info.Size()-3))
+
+	queue, err = OpenDurableQueue[string](dir)
+	assert.NilError(t, err)
+	assert.NilError(t, queue.Push("c", 3))
+	assert.NilError(t, queue.Close())
+
+	queue, err = OpenDurableQueue[string](dir)
+	assert.NilError(t, err)
+	defer queue.Close()
+	assert.DeepEqual(t, popAllDurable(t, queue), []string{"a", "c"})
+}
+
+func TestDurableQueue_Corrupted(t *testing.T) {
+	dir := t.TempDir()
+	queue, err := OpenDurableQueue[string](dir, WithSegmentSize(1), WithCompactionRatio(0))
+	assert.NilError(t, err)
+	assert.NilError(t, queue.Push("a", 1))
+	assert.NilError(t, queue.Push("b", 2))
+	assert.NilError(t, queue.Close())
+
+	segments := segmentFiles(t, dir)
+	assert.Equal(t, len(segments), 2)
+	b, err := os.ReadFile(segments[0])
+	assert.NilError(t, err)
+	b[len(b)-1] ^= 0xff
+	assert.NilError(t, os.WriteFile(segments[0], b, 0o644))
+
+	_, err = OpenDurableQueue[string](dir)
+	assert.Assert(t, errors.Is(err, ErrCorrupted), err)
+}
+
+func TestDurableQueue_CorruptedLastSegment(t *testing.T) {
+	dir := t.TempDir()
+	queue, err := OpenDurableQueue[string](dir)
+	assert.NilError(t, err)
+	for _, data := range []string{"a", "b", "c"} {
+		assert.NilError(t, queue.Push(data, 1))
+	}
+	assert.NilError(t, queue.Close())
+
+	segment := segmentFiles(t, dir)[0]
+	original, err := os.ReadFile(segment)
+	assert.NilError(t, err)
+	record := len(original) / 3
+
+	// a record failing its checksum at the end is a torn write
+	b := append([]byte{}, original...)
+	b[len(b)-1] ^= 0xff
+	assert.NilError(t, os.WriteFile(segment, b, 0o644))
+	queue, err = OpenDurableQueue[string](dir)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, popAllDurable(t, queue), []string{"a", "b"})
+	assert.NilError(t, queue.Close())
+
+	// but records after a corrupted one are not dropped
+	b = append([]byte{}, original...)
+	b[2*record-1] ^= 0xff
+	assert.NilError(t, os.WriteFile(segment, b, 0o644))
+	_, err = OpenDurableQueue[string](dir)
+	assert.Assert(t, errors.Is(err, ErrCorrupted), err)
+	info, err := os.Stat(segment)
+	assert.NilError(t, err)
+	assert.Equal(t, info.Size(), int64(len(original)))
+}
+
+func TestDurableQueue_RecoverBeyondCapacity(t *testing.T) {
+	dir := t.TempDir()
+	queue, err := OpenDurableQueue[string](dir)
+	assert.NilError(t, err)
+	for _, data := range []string{"a", "b", "c"} {
+		assert.NilError(t, queue.Push(data, 1))
+	}
+	assert.NilError(t, queue.Close())
+
+	queue, err = OpenDurableQueue[string](dir, WithPriorityQueueOptions(WithCapacity(2)))
+	assert.NilError(t, err)
+	defer queue.Close()
+	assert.Equal(t, queue.Len(), 3)
+	assert.Equal(t, queue.Push("d", 1), ErrFull)
+
+	for i := 0; i < 2; i++ {
+		_, ok, err := queue.Pop()
+		assert.NilError(t, err)
+		assert.Assert(t, ok)
+	}
+	assert.NilError(t, queue.Push("d", 1))
+}
+
+func TestDurableQueue_Compaction(t *testing.T) {
+	dir := t.TempDir()
+	queue, err := OpenDurableQueue[string](dir, WithSegmentSize(256), WithPriorityQueueOptions(WithMaxHeap()))
+	assert.NilError(t, err)
+
+	// a consumer that keeps up with the producer leaves only dead records
+	for i := 0; i < 100; i++ {
+		assert.NilError(t, queue.Push("transient", 0))
+		_, ok, err := queue.Pop()
+		assert.NilError(t, err)
+		assert.Assert(t, ok)
+	}
+	assert.NilError(t, queue.Push("kept", 1))
+	assert.NilError(t, queue.Push("kept first", 2))
+	assert.Assert(t, len(segmentFiles(t, dir)) <= 2)
+
+	assert.NilError(t, queue.Compact())
+	assert.Equal(t, len(segmentFiles(t, dir)), 1)
+	assert.NilError(t, queue.Close())
+
+	// an interrupted compaction is ignored
+	assert.NilError(t, os.WriteFile(filepath.Join(dir, "99999"+segmentExt+".tmp"), []byte("garbage"), 0o644))
+
+	queue, err = OpenDurableQueue[string](dir, WithPriorityQueueOptions(WithMaxHeap()))
+	assert.NilError(t, err)
+	defer queue.Close()
+	assert.DeepEqual(t, popAllDurable(t, queue), []string{"kept first", "kept"})
+	matches, err := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	assert.NilError(t, err)
+	assert.Equal(t, len(matches), 0)
+}
+
+func TestDurableQueue_PopWait(t *testing.T) {
+	queue, err := OpenDurableQueue[int](t.TempDir(), WithSyncInterval(10*time.Millisecond))
+	assert.NilError(t, err)
+
+	results := make(chan int)
+	go func() {
+		data, err := queue.PopWait(context.Background())
+		assert.Check(t, err)
+		results <- data
+	}()
+	time.Sleep(10 * time.Millisecond)
+	assert.NilError(t, queue.Push(1, 1))
+	assert.Equal(t, <-results, 1)
+
+	timeout, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = queue.PopWait(timeout)
+	assert.Assert(t, errors.Is(err, context.DeadlineExceeded))
+
+	errs := make(chan error)
+	go func() {
+		_, err := queue.PopWait(context.Background())
+		errs <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	assert.NilError(t, queue.Close())
+	assert.Equal(t, <-errs, ErrClosed)
+}
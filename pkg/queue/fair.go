@@ -0,0 +1,311 @@
+// Copyright 2022 Outreach Corporation. All Rights Reserved.
+
+// Description: Provides a weighted fair queue.
+
+package queue
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// This section defines fair queue default configuration.
+const (
+	// DefaultFairQueueWeight is the default weight of a key.
+	DefaultFairQueueWeight = 1
+
+	// DefaultFairQueueQuantum is the default quantum of deficit round-robin.
+	DefaultFairQueueQuantum = 1
+)
+
+// FairQueueOption is used to change fair queue default configuration.
+type FairQueueOption func(q *fairQueueConfig)
+
+// fairQueueConfig holds the configuration of a fair queue.
+type fairQueueConfig struct {
+	keyCapacity uint
+	weight      int
+	quantum     int
+	deficit     bool
+	keyOptions  []PriorityQueueOption
+}
+
+// WithKeyCapacity sets the capacity of the queue of each key.
+func WithKeyCapacity(v uint) FairQueueOption {
+	return func(q *fairQueueConfig) {
+		q.keyCapacity = v
+	}
+}
+
+// WithDefaultWeight sets the weight of the keys without one set by SetWeight.
+func WithDefaultWeight(v int) FairQueueOption {
+	return func(q *fairQueueConfig) {
+		q.weight = v
+	}
+}
+
+// WithWeightedRoundRobin makes the queue pop up to weight items of a key before moving to
+// the next key. This is the default.
+func WithWeightedRoundRobin() FairQueueOption {
+	return func(q *fairQueueConfig) {
+		q.deficit = false
+	}
+}
+
+// WithDeficitRoundRobin makes the queue credit each key with weight times quantum every
+// round, and pop items of the key while their cost is covered by its credit. Use it when
+// items have different costs, see PushWithCost.
+func WithDeficitRoundRobin(quantum int) FairQueueOption {
+	return func(q *fairQueueConfig) {
+		q.deficit = true
+		q.quantum = quantum
+	}
+}
+
+// WithKeyPriorityQueueOptions sets the options of the queue of each key, such as the heap
+// type. The capacity of the queue of each key is set with WithKeyCapacity.
+func WithKeyPriorityQueueOptions(opts ...PriorityQueueOption) FairQueueOption {
+	return func(q *fairQueueConfig) {
+		q.keyOptions = opts
+	}
+}
+
+// NewFairQueue creates a new fair queue. By default, keys have no capacity limit, the
+// same weight and are served with weighted round-robin.
+func NewFairQueue[K comparable, T any](opts ...FairQueueOption) *FairQueue[K, T] {
+	cfg := fairQueueConfig{
+		keyCapacity: DefaultPriorityQueueCapacity,
+		weight:      DefaultFairQueueWeight,
+		quantum:     DefaultFairQueueQuantum,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	// resolve the options of the queues of the keys on a priority queue, to share them
+	keyCfg := NewPriorityQueue(cfg.keyOptions...)
+	return &FairQueue[K, T]{
+		cfg:       cfg,
+		isMinHeap: keyCfg.queue.isMinHeap,
+		aging:     keyCfg.queue.aging,
+		keys:      map[K]*fairQueueKey[K]{},
+		weights:   map[K]int{},
+		stats:     map[K]*FairQueueStats{},
+	}
+}
+
+// FairQueue keeps a priority queue per key, for example per tenant, and pops items across
+// keys with weighted or deficit round-robin, so that a single key cannot starve the
+// others. Within a key, items are popped by priority.
+type FairQueue[K comparable, T any] struct {
+	lock      sync.Mutex
+	cfg       fairQueueConfig
+	isMinHeap bool
+	aging     time.Duration
+
+	// keys holds the keys with items, active is their round-robin order and next is the
+	// index of the key being served.
+	keys    map[K]*fairQueueKey[K]
+	active  []K
+	next    int
+	weights map[K]int
+	stats   map[K]*FairQueueStats
+}
+
+// FairQueueStats holds the statistics of a key of a fair queue.
+type FairQueueStats struct {
+	// Len is the number of items of the key in the queue.
+	Len int
+
+	// Pushed is the number of items of the key pushed into the queue.
+	Pushed uint64
+
+	// Popped is the number of items of the key popped from the queue.
+	Popped uint64
+
+	// Rejected is the number of items of the key rejected because the queue of the key
+	// was full.
+	Rejected uint64
+}
+
+// fairQueueKey is the queue of a key and its round-robin state.
+type fairQueueKey[K comparable] struct {
+	key   K
+	queue *priorityQueueInternal
+
+	// served is the number of items popped in the current turn of weighted
+	// round-robin, deficit is the credit left in deficit round-robin.
+	served  int
+	deficit int
+	visited bool
+}
+
+// fairQueueData is the data of an item in a fair queue.
+type fairQueueData[T any] struct {
+	data T
+	cost int
+}
+
+// SetWeight sets the weight of a key: the number of items popped per round with weighted
+// round-robin, or the multiple of the quantum credited per round with deficit
+// round-robin. Weights below one are treated as one.
+func (q *FairQueue[K, T]) SetWeight(key K, weight int) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.weights[key] = weight
+}
+
+// Push an item into the queue of a key. Push returns ErrFull if the queue of the key is at
+// capacity.
+func (q *FairQueue[K, T]) Push(key K, data T, priority int64) error {
+	return q.PushWithCost(key, data, priority, 1)
+}
+
+// PushWithCost pushes an item with the given cost into the queue of a key. The cost is
+// only used by deficit round-robin, costs below one are treated as one. PushWithCost
+// returns ErrFull if the queue of the key is at capacity.
+func (q *FairQueue[K, T]) PushWithCost(key K, data T, priority int64, cost int) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	stats := q.keyStats(key)
+	k, ok := q.keys[key]
+	if !ok {
+		k = &fairQueueKey[K]{key: key, queue: newPriorityQueueInternal(q.isMinHeap)}
+		k.queue.aging = q.aging
+	}
+	if uint(k.queue.Len()) >= q.cfg.keyCapacity {
+		stats.Rejected++
+		return ErrFull
+	}
+	if !ok {
+		q.keys[key] = k
+		q.active = append(q.active, key)
+	}
+
+	heap.Push(k.queue, newPriorityQueueItem(fairQueueData[T]{data: data, cost: max(cost, 1)}, priority))
+	stats.Len++
+	stats.Pushed++
+	return nil
+}
+
+// Pop removes and returns the next item in the queue, with its key. Pop returns false if
+// the queue is empty.
+func (q *FairQueue[K, T]) Pop() (key K, data T, ok bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for len(q.active) > 0 {
+		k := q.keys[q.active[q.next]]
+		weight := max(q.weight(k.key), 1)
+
+		if !q.cfg.deficit {
+			if k.served < weight {
+				k.served++
+				return q.pop(k)
+			}
+			k.served = 0
+			q.advance()
+			continue
+		}
+
+		if !k.visited {
+			k.visited = true
+			k.deficit += weight * max(q.cfg.quantum, 1)
+		}
+		if cost := k.queue.Peek().GetData().(fairQueueData[T]).cost; cost <= k.deficit {
+			k.deficit -= cost
+			return q.pop(k)
+		}
+		k.visited = false
+		q.advance()
+	}
+	return key, data, false
+}
+
+// pop removes and returns the first item of a key, dropping the key once it is empty.
+func (q *FairQueue[K, T]) pop(k *fairQueueKey[K]) (K, T, bool) {
+	item := heap.Pop(k.queue).(*PriorityQueueItem)
+	stats := q.keyStats(k.key)
+	stats.Len--
+	stats.Popped++
+
+	if k.queue.Len() == 0 {
+		delete(q.keys, k.key)
+		q.active = append(q.active[:q.next], q.active[q.next+1:]...)
+		if q.next >= len(q.active) {
+			q.next = 0
+		}
+	}
+	return k.key, item.GetData().(fairQueueData[T]).data, true
+}
+
+// advance moves the round-robin to the next key.
+func (q *FairQueue[K, T]) advance() {
+	q.next = (q.next + 1) % len(q.active)
+}
+
+// weight returns the weight of a key.
+func (q *FairQueue[K, T]) weight(key K) int {
+	if weight, ok := q.weights[key]; ok {
+		return weight
+	}
+	return q.cfg.weight
+}
+
+// keyStats returns the statistics of a key, creating them if needed.
+func (q *FairQueue[K, T]) keyStats(key K) *FairQueueStats {
+	stats, ok := q.stats[key]
+	if !ok {
+		stats = &FairQueueStats{}
+		q.stats[key] = stats
+	}
+	return stats
+}
+
+// Len returns the number of items in the queue.
+func (q *FairQueue[K, T]) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	n := 0
+	for _, k := range q.keys {
+		n += k.queue.Len()
+	}
+	return n
+}
+
+// KeyLen returns the number of items of a key in the queue.
+func (q *FairQueue[K, T]) KeyLen(key K) int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if k, ok := q.keys[key]; ok {
+		return k.queue.Len()
+	}
+	return 0
+}
+
+// Stats returns the statistics of every key pushed into the queue since it was created,
+// or since the last call to ResetStats.
+func (q *FairQueue[K, T]) Stats() map[K]FairQueueStats {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	stats := make(map[K]FairQueueStats, len(q.stats))
+	for key, s := range q.stats {
+		stats[key] = *s
+	}
+	return stats
+}
+
+// ResetStats resets the Pushed, Popped and Rejected counters, and forgets the keys without
+// items in the queue.
+func (q *FairQueue[K, T]) ResetStats() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for key, s := range q.stats {
+		if s.Len == 0 {
+			delete(q.stats, key)
+			continue
+		}
+		*s = FairQueueStats{Len: s.Len}
+	}
+}
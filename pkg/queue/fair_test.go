@@ -0,0 +1,80 @@
+package queue
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// popAll pops all the items of a fair queue, as key:data.
+func popAll(queue *FairQueue[string, string]) []string {
+	popped := []string{}
+	for {
+		key, data, ok := queue.Pop()
+		if !ok {
+			return popped
+		}
+		popped = append(popped, key+":"+data)
+	}
+}
+
+func TestFairQueue_WeightedRoundRobin(t *testing.T) {
+	queue := NewFairQueue[string, string]()
+	queue.SetWeight("big", 2)
+
+	// the noisy tenant pushes first, by priority within the tenant
+	for _, data := range []string{"3", "1", "2", "4", "5"} {
+		assert.NilError(t, queue.Push("noisy", data, int64(data[0]-'0')))
+	}
+	assert.NilError(t, queue.Push("quiet", "1", 1))
+	assert.NilError(t, queue.Push("big", "1", 1))
+	assert.NilError(t, queue.Push("big", "2", 2))
+	assert.NilError(t, queue.Push("big", "3", 3))
+	assert.Equal(t, queue.Len(), 9)
+	assert.Equal(t, queue.KeyLen("noisy"), 5)
+
+	assert.DeepEqual(t, popAll(queue), []string{
+		"noisy:1", "quiet:1", "big:1", "big:2",
+		"noisy:2", "big:3",
+		"noisy:3",
+		"noisy:4",
+		"noisy:5",
+	})
+	assert.Equal(t, queue.Len(), 0)
+}
+
+func TestFairQueue_DeficitRoundRobin(t *testing.T) {
+	queue := NewFairQueue[string, string](WithDeficitRoundRobin(2), WithKeyPriorityQueueOptions(WithMaxHeap()))
+
+	// a tenant with expensive items gets fewer of them through per round
+	assert.NilError(t, queue.PushWithCost("heavy", "a", 2, 2))
+	assert.NilError(t, queue.PushWithCost("heavy", "b", 1, 2))
+	for _, data := range []string{"a", "b", "c", "d"} {
+		assert.NilError(t, queue.Push("light", data, int64('z'-data[0])))
+	}
+
+	assert.DeepEqual(t, popAll(queue), []string{
+		"heavy:a", "light:a", "light:b",
+		"heavy:b", "light:c", "light:d",
+	})
+}
+
+func TestFairQueue_KeyCapacity(t *testing.T) {
+	queue := NewFairQueue[string, string](WithKeyCapacity(2))
+
+	assert.NilError(t, queue.Push("noisy", "1", 1))
+	assert.NilError(t, queue.Push("noisy", "2", 2))
+	assert.Equal(t, queue.Push("noisy", "3", 3), ErrFull)
+	assert.NilError(t, queue.Push("quiet", "1", 1))
+
+	_, _, ok := queue.Pop()
+	assert.Assert(t, ok)
+	assert.DeepEqual(t, queue.Stats(), map[string]FairQueueStats{
+		"noisy": {Len: 1, Pushed: 2, Popped: 1, Rejected: 1},
+		"quiet": {Len: 1, Pushed: 1},
+	})
+
+	popAll(queue)
+	queue.ResetStats()
+	assert.DeepEqual(t, queue.Stats(), map[string]FairQueueStats{})
+}
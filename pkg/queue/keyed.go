@@ -0,0 +1,141 @@
+// Copyright 2022 Outreach Corporation. All Rights Reserved.
+
+// Description: Provides a priority queue of keyed items.
+
+package queue
+
+import (
+	"container/heap"
+	"sync"
+)
+
+// NewKeyedPriorityQueue creates a new keyed priority queue. It accepts the same options as
+// NewPriorityQueue.
+func NewKeyedPriorityQueue[K comparable, T any](opts ...PriorityQueueOption) *KeyedPriorityQueue[K, T] {
+	// resolve the options on a priority queue, to share them
+	cfg := NewPriorityQueue(opts...)
+	return &KeyedPriorityQueue[K, T]{
+		capacity: cfg.capacity,
+		queue:    cfg.queue,
+		items:    map[K]*PriorityQueueItem{},
+	}
+}
+
+// KeyedPriorityQueue is a priority queue whose items are addressed by a key instead of
+// the PriorityQueueItem returned by Push. Pushing a key that is already in the queue
+// updates its item, which makes the queue a deduplicating work queue. All operations
+// on a key are O(log n).
+type KeyedPriorityQueue[K comparable, T any] struct {
+	lock     sync.RWMutex
+	capacity uint
+	queue    *priorityQueueInternal
+	items    map[K]*PriorityQueueItem
+}
+
+// keyedData is the data of an item in a keyed priority queue.
+type keyedData[K comparable, T any] struct {
+	key  K
+	data T
+}
+
+// Upsert pushes an item with the given key into the queue, or updates the data and
+// priority of the item if the key is already in the queue. Upsert returns true if the
+// item was inserted, and ErrFull if the queue is at capacity.
+func (q *KeyedPriorityQueue[K, T]) Upsert(key K, data T, priority int64) (bool, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if item, ok := q.items[key]; ok {
+		item.SetData(keyedData[K, T]{key: key, data: data})
+		item.SetPriority(priority)
+		heap.Fix(q.queue, item.getIndex())
+		return false, nil
+	}
+
+	if uint(q.queue.Len()) >= q.capacity {
+		return false, ErrFull
+	}
+	item := newPriorityQueueItem(keyedData[K, T]{key: key, data: data}, priority)
+	heap.Push(q.queue, item)
+	q.items[key] = item
+	return true, nil
+}
+
+// Pop removes and returns the first item in the queue, with its key. Pop returns false if
+// the queue is empty.
+func (q *KeyedPriorityQueue[K, T]) Pop() (key K, data T, ok bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.queue.Len() <= 0 {
+		return key, data, false
+	}
+	d := heap.Pop(q.queue).(*PriorityQueueItem).GetData().(keyedData[K, T])
+	delete(q.items, d.key)
+	return d.key, d.data, true
+}
+
+// Peek returns the first item in the queue, with its key. Peek returns false if the queue
+// is empty.
+func (q *KeyedPriorityQueue[K, T]) Peek() (key K, data T, ok bool) {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	if q.queue.Len() <= 0 {
+		return key, data, false
+	}
+	d := q.queue.Peek().GetData().(keyedData[K, T])
+	return d.key, d.data, true
+}
+
+// GetKey returns the data and priority of the item with the given key. GetKey returns
+// false if the key is not in the queue.
+func (q *KeyedPriorityQueue[K, T]) GetKey(key K) (data T, priority int64, ok bool) {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	item, ok := q.items[key]
+	if !ok {
+		return data, 0, false
+	}
+	return item.GetData().(keyedData[K, T]).data, item.GetPriority(), true
+}
+
+// ContainsKey returns true if the key is in the queue.
+func (q *KeyedPriorityQueue[K, T]) ContainsKey(key K) bool {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	_, ok := q.items[key]
+	return ok
+}
+
+// RemoveKey removes the item with the given key from the queue and returns its data.
+// RemoveKey returns false if the key is not in the queue.
+func (q *KeyedPriorityQueue[K, T]) RemoveKey(key K) (data T, ok bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	item, ok := q.items[key]
+	if !ok {
+		return data, false
+	}
+	index := item.getIndex()
+	q.queue.Remove(index)
+	// Fix the index if removed item is not the last one.
+	if index < q.queue.Len() {
+		heap.Fix(q.queue, index)
+	}
+	delete(q.items, key)
+	return item.GetData().(keyedData[K, T]).data, true
+}
+
+// Clear removes all items in the queue.
+func (q *KeyedPriorityQueue[K, T]) Clear() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.queue.Clear()
+	q.items = map[K]*PriorityQueueItem{}
+}
+
+// Len returns the number of items in the queue.
+func (q *KeyedPriorityQueue[K, T]) Len() int {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	return q.queue.Len()
+}
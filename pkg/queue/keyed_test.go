@@ -0,0 +1,82 @@
+package queue
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestKeyedPriorityQueue_Upsert(t *testing.T) {
+	queue := NewKeyedPriorityQueue[string, int](WithCapacity(3))
+
+	inserted, err := queue.Upsert("a", 1, 10)
+	assert.NilError(t, err)
+	assert.Assert(t, inserted)
+	_, err = queue.Upsert("b", 2, 20)
+	assert.NilError(t, err)
+	_, err = queue.Upsert("c", 3, 30)
+	assert.NilError(t, err)
+	_, err = queue.Upsert("d", 4, 40)
+	assert.Equal(t, err, ErrFull)
+
+	// updating a key does not need room, and moves the item
+	inserted, err = queue.Upsert("c", 33, 5)
+	assert.NilError(t, err)
+	assert.Assert(t, !inserted)
+	assert.Equal(t, queue.Len(), 3)
+
+	data, priority, ok := queue.GetKey("c")
+	assert.Assert(t, ok)
+	assert.Equal(t, data, 33)
+	assert.Equal(t, priority, int64(5))
+
+	key, data, ok := queue.Peek()
+	assert.Assert(t, ok)
+	assert.Equal(t, key, "c")
+	assert.Equal(t, data, 33)
+
+	for _, expected := range []string{"c", "a", "b"} {
+		key, _, ok := queue.Pop()
+		assert.Assert(t, ok)
+		assert.Equal(t, key, expected)
+		assert.Assert(t, !queue.ContainsKey(key))
+	}
+	_, _, ok = queue.Pop()
+	assert.Assert(t, !ok)
+}
+
+func TestKeyedPriorityQueue_RemoveKey(t *testing.T) {
+	queue := NewKeyedPriorityQueue[int, string](WithMaxHeap())
+
+	n := 100
+	for _, i := range rand.Perm(n) {
+		_, err := queue.Upsert(i, fmt.Sprint(i), int64(i))
+		assert.NilError(t, err)
+	}
+
+	// remove the odd keys
+	for i := 1; i < n; i += 2 {
+		data, ok := queue.RemoveKey(i)
+		assert.Assert(t, ok)
+		assert.Equal(t, data, fmt.Sprint(i))
+	}
+	_, ok := queue.RemoveKey(1)
+	assert.Assert(t, !ok)
+	assert.Assert(t, queue.ContainsKey(2))
+	assert.Assert(t, !queue.ContainsKey(3))
+	assert.Equal(t, queue.Len(), n/2)
+
+	for i := n - 2; i >= 0; i -= 2 {
+		key, _, ok := queue.Pop()
+		assert.Assert(t, ok)
+		assert.Equal(t, key, i)
+	}
+
+	_, err := queue.Upsert(1, "1", 1)
+	assert.NilError(t, err)
+	queue.Clear()
+	assert.Equal(t, queue.Len(), 0)
+	assert.Assert(t, !queue.ContainsKey(1))
+}
@@ -46,6 +46,87 @@
 //	pq, _ = queue.NewPriorityQueue(queue.WithMaxHeap())
 //	pq.Push(1, 1)	// lower priority
 //	pq.Push(2, 2)	// higher priority
+//
+// When the queue is at capacity, Push rejects the item by default. It can instead evict the
+// item with the lowest priority or the oldest item, which PushEvict returns.
+//
+//	pq := queue.NewPriorityQueue(queue.WithCapacity(100), queue.WithOverflowPolicy(queue.OverflowEvictLowest))
+//	_, evicted, err := pq.PushEvict(job, job.Priority)
+//
+// With aging, items gain one priority for every period they wait, so that items with a
+// low priority eventually get popped.
+//
+//	pq := queue.NewPriorityQueue(queue.WithAging(time.Minute))
+//
+// # Blocking Priority Queue
+//
+// BlockingPriorityQueue is a generic priority queue for producers and consumers.
+// PopWait waits for an item while the queue is empty, and PushWait waits for room
+// while the queue is at capacity. Closing the queue wakes up all the waiters.
+//
+//	pq := queue.NewBlockingPriorityQueue[*Job](queue.WithCapacity(100))
+//
+//	// producer
+//	err := pq.PushWait(ctx, job, job.Priority)
+//
+//	// consumer
+//	for {
+//		job, err := pq.PopWait(ctx)
+//		if err != nil {
+//			return err // queue.ErrClosed once closed and drained
+//		}
+//		job.Run(ctx)
+//	}
+//
+// # Delay Queue
+//
+// DelayQueue holds items until a given time, for delayed jobs and retries. PopWait
+// waits until the first item becomes visible. Pending items can be rescheduled with
+// Update and canceled with Remove.
+//
+//	dq := queue.NewDelayQueue[*Job]()
+//	item, _ := dq.PushAfter(job, 30*time.Second)
+//
+//	dq.Update(item, time.Now().Add(time.Minute))	// reschedule
+//	dq.Remove(item)					// cancel
+//
+//	job, err := dq.PopWait(ctx)
+//
+// # Fair Queue
+//
+// FairQueue keeps a priority queue per key, for example per tenant, and pops items
+// across keys with weighted round-robin, or deficit round-robin when items have
+// different costs, so that a single key cannot starve the others.
+//
+//	fq := queue.NewFairQueue[string, *Job](queue.WithKeyCapacity(1000))
+//	fq.SetWeight("enterprise", 4)
+//
+//	err := fq.Push(job.TenantID, job, job.Priority)	// queue.ErrFull when the tenant is at capacity
+//	tenantID, job, ok := fq.Pop()
+//
+// # Keyed Priority Queue
+//
+// KeyedPriorityQueue addresses items by a comparable key instead of the item returned by
+// Push, which makes it a deduplicating work queue.
+//
+//	kq := queue.NewKeyedPriorityQueue[string, *Job]()
+//
+//	kq.Upsert(job.ID, job, job.Priority)	// push, or update the queued job
+//	kq.RemoveKey(job.ID)			// cancel
+//	id, job, ok := kq.Pop()
+//
+// # Durable Queue
+//
+// DurableQueue is a priority queue persisted in an append-only log of segment files, so
+// that the items survive a restart of the process or of the node. Records are checksummed,
+// the log is fsynced according to the sync policy and compacted when its segments are
+// mostly made of popped items.
+//
+//	dq, err := queue.OpenDurableQueue[*Job]("/var/lib/worker/jobs", queue.WithSyncInterval(100*time.Millisecond))
+//	defer dq.Close()
+//
+//	err = dq.Push(job, job.Priority)
+//	job, err := dq.PopWait(ctx)
 package queue
 
 import (
@@ -53,6 +134,7 @@ import (
 	"math"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -63,6 +145,19 @@ const (
 	DefaultPriorityQueueCapacity = math.MaxUint
 )
 
+// This section defines errors.
+var (
+	// ErrFull is returned when pushing an item into a queue at capacity.
+	ErrFull = errors.New("queue is full")
+
+	// ErrClosed is returned when pushing an item into a closed queue, or
+	// waiting on a queue that is closed and empty.
+	ErrClosed = errors.New("queue is closed")
+
+	// ErrNotInQueue is returned when updating an item that is not in the queue.
+	ErrNotInQueue = errors.New("item is not in queue")
+)
+
 // PriorityQueueOption is used to change priority default configuration.
 type PriorityQueueOption func(q *PriorityQueue)
 
@@ -89,6 +184,46 @@ func WithMaxHeap() PriorityQueueOption {
 	}
 }
 
+// OverflowPolicy defines what Push does when the queue is at capacity.
+type OverflowPolicy int
+
+// This section defines overflow policies.
+const (
+	// OverflowReject rejects the pushed item with ErrFull. This is the default.
+	OverflowReject OverflowPolicy = iota
+
+	// OverflowEvictLowest evicts the item with the lowest priority, which is the pushed
+	// item itself when it has the lowest priority, in which case it is rejected with
+	// ErrFull.
+	OverflowEvictLowest
+
+	// OverflowEvictOldest evicts the item that was pushed first.
+	OverflowEvictOldest
+)
+
+// WithOverflowPolicy sets what Push does when the queue is at capacity. Use PushEvict to
+// get the evicted item back, for example to dead-letter it. It only applies to
+// PriorityQueue, the other queues reject items with ErrFull.
+func WithOverflowPolicy(v OverflowPolicy) PriorityQueueOption {
+	return func(q *PriorityQueue) {
+		q.overflow = v
+	}
+}
+
+// WithAging makes items gain one priority for every given duration they wait in the queue,
+// so that items with a low priority eventually get popped. Aging does not change the
+// priority of the items: an item pushed later is treated as if its priority was lower
+// by the time elapsed since, divided by the given duration.
+//
+// Priorities are compared once multiplied by the duration, and the products saturate at
+// the bounds of int64: priorities beyond math.MaxInt64 divided by the duration in
+// nanoseconds, in either direction, are treated as equal.
+func WithAging(every time.Duration) PriorityQueueOption {
+	return func(q *PriorityQueue) {
+		q.queue.aging = every
+	}
+}
+
 // NewPriorityQueue creates a new priority queue.
 func NewPriorityQueue(opts ...PriorityQueueOption) *PriorityQueue {
 	q := &PriorityQueue{
@@ -107,21 +242,51 @@ func NewPriorityQueue(opts ...PriorityQueueOption) *PriorityQueue {
 type PriorityQueue struct {
 	lock     sync.RWMutex
 	capacity uint
+	overflow OverflowPolicy
 	queue    *priorityQueueInternal
 }
 
 // Push an item into the queue. Items in the queue will be sorted by priority. Push returns
 // a PriorityQueueItem that can be used for other operations, such as updating item priority
-// or removing the item from the queue.
+// or removing the item from the queue. When the queue is at capacity, Push behaves as set
+// by WithOverflowPolicy.
 func (q *PriorityQueue) Push(data interface{}, priority int64) (*PriorityQueueItem, error) {
+	item, _, err := q.PushEvict(data, priority)
+	return item, err
+}
+
+// PushEvict pushes an item into the queue like Push, and also returns the item evicted to
+// make room for it, if any.
+func (q *PriorityQueue) PushEvict(data interface{}, priority int64) (item, evicted *PriorityQueueItem, err error) {
 	q.lock.Lock()
 	defer q.lock.Unlock()
+	if q.capacity == 0 {
+		return nil, nil, ErrFull
+	}
+	item = newPriorityQueueItem(data, priority)
 	if uint(q.queue.Len()) >= q.capacity {
-		return nil, errors.New("queue is full")
+		var index int
+		switch q.overflow {
+		case OverflowEvictLowest:
+			index = q.queue.Lowest()
+			if !q.queue.less(item, q.queue.Get(index)) {
+				return nil, nil, ErrFull
+			}
+		case OverflowEvictOldest:
+			index = q.queue.Oldest()
+		case OverflowReject:
+			fallthrough
+		default:
+			return nil, nil, ErrFull
+		}
+		evicted = q.queue.Remove(index)
+		// Fix the index if removed item is not the last one.
+		if index < q.queue.Len() {
+			heap.Fix(q.queue, index)
+		}
 	}
-	item := newPriorityQueueItem(data, priority)
 	heap.Push(q.queue, item)
-	return item, nil
+	return item, evicted, nil
 }
 
 // Pop removes and returns the first item in the queue. Pop returns nil if the queue is empty.
@@ -151,7 +316,7 @@ func (q *PriorityQueue) Update(item *PriorityQueueItem) error {
 	q.lock.Lock()
 	defer q.lock.Unlock()
 	if !q.contains(item) {
-		return errors.New("item is not in queue")
+		return ErrNotInQueue
 	}
 	heap.Fix(q.queue, item.getIndex())
 	return nil
@@ -182,15 +347,7 @@ func (q *PriorityQueue) Contains(item *PriorityQueueItem) bool {
 }
 
 func (q *PriorityQueue) contains(item *PriorityQueueItem) bool {
-	if item == nil {
-		return false
-	}
-	index := item.getIndex()
-	if index <= -1 || index >= q.queue.Len() {
-		return false
-	}
-	// Compare the memory address to ensure they are the same item.
-	return item == q.queue.Get(index)
+	return q.queue.Contains(item)
 }
 
 // Clear removes all items in the queue.
@@ -220,6 +377,7 @@ type PriorityQueueItem struct {
 	data     interface{}
 	priority int64
 	index    int
+	pushedAt time.Time
 }
 
 // newPriorityQueueItem creates a new priority queue item.
@@ -227,9 +385,15 @@ func newPriorityQueueItem(data interface{}, priority int64) *PriorityQueueItem {
 	return &PriorityQueueItem{
 		data:     data,
 		priority: priority,
+		pushedAt: time.Now(),
 	}
 }
 
+// GetPushedAt returns the time the item was pushed.
+func (i *PriorityQueueItem) GetPushedAt() time.Time {
+	return i.pushedAt
+}
+
 // GetData returns the data.
 func (i *PriorityQueueItem) GetData() interface{} {
 	i.lock.RLock()
@@ -281,6 +445,11 @@ var _ heap.Interface = (*priorityQueueInternal)(nil)
 type priorityQueueInternal struct {
 	isMinHeap bool
 	items     []*PriorityQueueItem
+
+	// aging is the time it takes an item to gain one priority, zero without aging. The
+	// age of an item is measured from epoch.
+	aging time.Duration
+	epoch time.Time
 }
 
 // newPriorityQueueInternal creates a new priorityQueueInternal.
@@ -288,6 +457,7 @@ func newPriorityQueueInternal(isMinHeap bool) *priorityQueueInternal {
 	return &priorityQueueInternal{
 		isMinHeap: isMinHeap,
 		items:     []*PriorityQueueItem{},
+		epoch:     time.Now(),
 	}
 }
 
@@ -319,11 +489,48 @@ func (q *priorityQueueInternal) Remove(i int) *PriorityQueueItem {
 	return item
 }
 
+// Contains returns true if the item is in the queue.
+func (q *priorityQueueInternal) Contains(item *PriorityQueueItem) bool {
+	if item == nil {
+		return false
+	}
+	index := item.getIndex()
+	if index <= -1 || index >= q.Len() {
+		return false
+	}
+	// Compare the memory address to ensure they are the same item.
+	return item == q.Get(index)
+}
+
 // Clear emptys the queue.
 func (q *priorityQueueInternal) Clear() {
 	q.items = []*PriorityQueueItem{}
 }
 
+// Lowest returns the index of the item with the lowest priority, the one that would be
+// popped last. The queue must not be empty.
+func (q *priorityQueueInternal) Lowest() int {
+	lowest := 0
+	// the lowest priority is a leaf of the heap
+	for i := q.Len() / 2; i < q.Len(); i++ {
+		if q.less(q.items[lowest], q.items[i]) {
+			lowest = i
+		}
+	}
+	return lowest
+}
+
+// Oldest returns the index of the item pushed first. The queue must not be empty.
+func (q *priorityQueueInternal) Oldest() int {
+	oldest := 0
+	for i := range q.items {
+		if q.items[i].pushedAt.Before(q.items[oldest].pushedAt) {
+			oldest = i
+		}
+	}
+	return oldest
+}
+
 // Get returns an item at index i
 func (q *priorityQueueInternal) Get(i int) *PriorityQueueItem {
 	return q.items[i]
@@ -334,10 +541,7 @@ func (q *priorityQueueInternal) List() []*PriorityQueueItem {
 	items := make([]*PriorityQueueItem, q.Len())
 	copy(items, q.items)
 	sort.SliceStable(items, func(i, j int) bool {
-		if q.isMinHeap {
-			return items[i].GetPriority() < items[j].GetPriority()
-		}
-		return items[i].GetPriority() > items[j].GetPriority()
+		return q.less(items[i], items[j])
 	})
 	return items
 }
@@ -349,10 +553,49 @@ func (q priorityQueueInternal) Len() int {
 
 // Less compares items at index i and j.
 func (q priorityQueueInternal) Less(i, j int) bool {
+	return q.less(q.items[i], q.items[j])
+}
+
+// less returns true if item a is popped before item b.
+func (q priorityQueueInternal) less(a, b *PriorityQueueItem) bool {
+	if q.aging <= 0 {
+		if q.isMinHeap {
+			return a.GetPriority() < b.GetPriority()
+		}
+		return a.GetPriority() > b.GetPriority()
+	}
+
+	// an item pushed later has waited less, which is the same as a lower priority. As all
+	// items age at the same pace, their order never changes and aging never breaks the
+	// heap.
+	ka, kb := saturatingMul(a.GetPriority(), int64(q.aging)), saturatingMul(b.GetPriority(), int64(q.aging))
+	ageA, ageB := int64(a.pushedAt.Sub(q.epoch)), int64(b.pushedAt.Sub(q.epoch))
 	if q.isMinHeap {
-		return q.items[i].GetPriority() < q.items[j].GetPriority()
+		return saturatingAdd(ka, ageA) < saturatingAdd(kb, ageB)
+	}
+	return saturatingAdd(ka, -ageA) > saturatingAdd(kb, -ageB)
+}
+
+// saturatingMul returns a*b, clamped to the bounds of int64. b must be positive.
+func saturatingMul(a, b int64) int64 {
+	switch {
+	case a > math.MaxInt64/b:
+		return math.MaxInt64
+	case a < math.MinInt64/b:
+		return math.MinInt64
+	}
+	return a * b
+}
+
+// saturatingAdd returns a+b, clamped to the bounds of int64.
+func saturatingAdd(a, b int64) int64 {
+	switch {
+	case b > 0 && a > math.MaxInt64-b:
+		return math.MaxInt64
+	case b < 0 && a < math.MinInt64-b:
+		return math.MinInt64
 	}
-	return q.items[i].GetPriority() > q.items[j].GetPriority()
+	return a + b
 }
 
 // Swap items at index i and j.
@@ -1,9 +1,11 @@
 package queue
 
 import (
+	"math"
 	"math/rand"
 	"sort"
 	"testing"
+	"time"
 
 	"gotest.tools/v3/assert"
 	"gotest.tools/v3/assert/cmp"
@@ -296,6 +298,97 @@ func TestPriorityQueue_Remove_Invalid_Item(t *testing.T) {
 	assert.Assert(t, queue.Len() == 0)
 }
 
+func TestPriorityQueue_Overflow(t *testing.T) {
+	// reject
+	queue := NewPriorityQueue(WithCapacity(2))
+	pushRandNumbersToPriorityQueue(t, queue, 2)
+	item, evicted, err := queue.PushEvict(2, 2)
+	assert.Assert(t, err == ErrFull)
+	assert.Assert(t, item == nil && evicted == nil)
+
+	// evict lowest
+	queue = NewPriorityQueue(WithCapacity(3), WithOverflowPolicy(OverflowEvictLowest))
+	pushRandNumbersToPriorityQueue(t, queue, 3)
+	item, evicted, err = queue.PushEvict(-1, -1)
+	assert.Assert(t, err == nil)
+	assert.Assert(t, item.GetData() == -1)
+	assert.Assert(t, evicted.GetData() == int64(2))
+	assert.Assert(t, !queue.Contains(evicted))
+	assert.Assert(t, queue.Len() == 3)
+
+	// the pushed item is the lowest
+	_, err = queue.Push(5, 5)
+	assert.Assert(t, err == ErrFull)
+	assert.Assert(t, queue.Pop().GetData() == -1)
+
+	// evict oldest
+	queue = NewPriorityQueue(WithCapacity(3), WithOverflowPolicy(OverflowEvictOldest))
+	oldest, err := queue.Push("oldest", 1)
+	assert.Assert(t, err == nil)
+	for _, v := range []string{"older", "old"} {
+		_, err = queue.Push(v, 2)
+		assert.Assert(t, err == nil)
+	}
+	_, evicted, err = queue.PushEvict("new", 3)
+	assert.Assert(t, err == nil)
+	assert.Assert(t, evicted == oldest)
+	_, evicted, err = queue.PushEvict("newer", 0)
+	assert.Assert(t, err == nil)
+	assert.Assert(t, evicted.GetData() == "older")
+	assert.Assert(t, queue.Pop().GetData() == "newer")
+}
+
+func TestPriorityQueue_Aging(t *testing.T) {
+	queue := NewPriorityQueue(WithAging(10 * time.Millisecond))
+	_, err := queue.Push("low", 3)
+	assert.Assert(t, err == nil)
+	time.Sleep(30 * time.Millisecond)
+	_, err = queue.Push("medium", 2)
+	assert.Assert(t, err == nil)
+	_, err = queue.Push("high", 1)
+	assert.Assert(t, err == nil)
+
+	// low waited more than two aging periods, it is now worth a high priority
+	items := queue.List()
+	assert.Assert(t, items[0].GetData() == "low")
+	assert.Assert(t, queue.Pop().GetData() == "low")
+	assert.Assert(t, queue.Pop().GetData() == "high")
+	assert.Assert(t, queue.Pop().GetData() == "medium")
+
+	// with a max heap
+	queue = NewPriorityQueue(WithMaxHeap(), WithAging(10*time.Millisecond))
+	_, err = queue.Push("low", 1)
+	assert.Assert(t, err == nil)
+	time.Sleep(30 * time.Millisecond)
+	_, err = queue.Push("high", 3)
+	assert.Assert(t, err == nil)
+	assert.Assert(t, queue.Pop().GetData() == "low")
+}
+
+func TestPriorityQueue_AgingOverflow(t *testing.T) {
+	// 1e10 minutes overflow int64 nanoseconds
+	queue := NewPriorityQueue(WithAging(time.Minute))
+	for _, p := range []int64{1e10, 1, math.MaxInt64, -1e10} {
+		_, err := queue.Push(p, p)
+		assert.Assert(t, err == nil)
+	}
+	assert.Assert(t, queue.Pop().GetData() == int64(-1e10))
+	assert.Assert(t, queue.Pop().GetData() == int64(1))
+	// both saturate, their order is unspecified
+	last := []interface{}{queue.Pop().GetData(), queue.Pop().GetData()}
+	assert.Assert(t, cmp.Contains(last, int64(1e10)))
+	assert.Assert(t, cmp.Contains(last, int64(math.MaxInt64)))
+
+	queue = NewPriorityQueue(WithMaxHeap(), WithAging(time.Minute))
+	for _, p := range []int64{1, -1e10, 1e10} {
+		_, err := queue.Push(p, p)
+		assert.Assert(t, err == nil)
+	}
+	assert.Assert(t, queue.Pop().GetData() == int64(1e10))
+	assert.Assert(t, queue.Pop().GetData() == int64(1))
+	assert.Assert(t, queue.Pop().GetData() == int64(-1e10))
+}
+
 // push N numbers into queue in random push order.
 func pushRandNumbersToPriorityQueue(t *testing.T, queue *PriorityQueue, n int) []*PriorityQueueItem {
 	nums := make([]int64, n)
@@ -0,0 +1,102 @@
+// Description: Provides a per-key rate limiter
+
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// KeyedLimiter keeps a separate Limiter per key, for example per tenant
+// or per client IP.
+//
+// Keys unused for longer than the IdleTimeout option are forgotten. The
+// timeout should be longer than the time a limiter takes to recover all
+// its permits, so that forgetting a key does not reset its limit early.
+//
+//	limiter := ratelimit.NewKeyedLimiter(func() ratelimit.Limiter {
+//	    return ratelimit.NewSlidingWindow(100, time.Minute, ratelimit.WithName("api"))
+//	})
+//
+//	if err := limiter.Allow(tenantID); err != nil {
+//	    return err
+//	}
+type KeyedLimiter struct {
+	newLimiter  func() Limiter
+	idleTimeout time.Duration
+
+	mu        sync.Mutex
+	limiters  map[string]*keyedEntry
+	lastSweep time.Time
+}
+
+// keyedEntry is the limiter of a key.
+type keyedEntry struct {
+	limiter  Limiter
+	lastUsed time.Time
+}
+
+// NewKeyedLimiter creates a per-key limiter. newLimiter is called to
+// create the limiter of every new key. Only the IdleTimeout option
+// applies to KeyedLimiter, the name of the limiters is set by
+// newLimiter.
+func NewKeyedLimiter(newLimiter func() Limiter, options ...Option) *KeyedLimiter {
+	opts := newOptions(options)
+	return &KeyedLimiter{
+		newLimiter:  newLimiter,
+		idleTimeout: opts.IdleTimeout,
+		limiters:    map[string]*keyedEntry{},
+		lastSweep:   time.Now(),
+	}
+}
+
+// Allow takes a permit for key if one is available right away, and
+// returns a limit exceeded error otherwise.
+func (k *KeyedLimiter) Allow(key string) error {
+	return k.limiter(key).Allow()
+}
+
+// Wait blocks until a permit is available for key, see Limiter.
+func (k *KeyedLimiter) Wait(ctx context.Context, key string) error {
+	return k.limiter(key).Wait(ctx)
+}
+
+// Len returns the number of keys with a limiter.
+func (k *KeyedLimiter) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.limiters)
+}
+
+// limiter returns the limiter of key, creating it if needed.
+func (k *KeyedLimiter) limiter(key string) Limiter {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := time.Now()
+	k.sweep(now)
+
+	e, ok := k.limiters[key]
+	if !ok {
+		e = &keyedEntry{limiter: k.newLimiter()}
+		k.limiters[key] = e
+	}
+	e.lastUsed = now
+	return e.limiter
+}
+
+// sweep forgets the idle keys, at most once per IdleTimeout. It must be
+// called with the lock held.
+func (k *KeyedLimiter) sweep(now time.Time) {
+	if now.Sub(k.lastSweep) < k.idleTimeout {
+		return
+	}
+	k.lastSweep = now
+
+	for key, e := range k.limiters {
+		if now.Sub(e.lastUsed) >= k.idleTimeout {
+			delete(k.limiters, key)
+		}
+	}
+}
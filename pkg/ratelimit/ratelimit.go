@@ -0,0 +1,106 @@
+// Description: Provides rate limiters that report rejections as orerr.LimitExceededError
+
+// Package ratelimit provides rate limiters: a token bucket, a sliding
+// window and a per-key limiter built on top of either.
+//
+// Every limiter supports a non-blocking Allow and a blocking Wait. When
+// a limit is hit, the returned error is an orerr.LimitExceededError
+// wrapped with statuscodes.RateLimited, so that metrics record the
+// rejections as client errors:
+//
+//	limiter := ratelimit.NewTokenBucket(100, 10, ratelimit.WithName("emails"))
+//
+//	if err := limiter.Allow(); err != nil {
+//	    return err // emails limit exceeded, with the RateLimited status code
+//	}
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/grevych/gobox/pkg/orerr"
+	"github.com/grevych/gobox/pkg/statuscodes"
+)
+
+// Limiter is a rate limiter.
+type Limiter interface {
+	// Allow takes a permit if one is available right away, and returns
+	// a limit exceeded error otherwise.
+	Allow() error
+
+	// Wait blocks until a permit is available. It returns a limit
+	// exceeded error without waiting if no permit is available before
+	// the deadline of ctx, and ctx.Err() if ctx is done while waiting.
+	Wait(ctx context.Context) error
+}
+
+// Options contains the options for the rate limiters.
+type Options struct {
+	// Name is the kind of the LimitExceededError returned by the
+	// limiter, "rate" by default.
+	Name string
+
+	// IdleTimeout is the time after which an unused key is forgotten by
+	// a KeyedLimiter, 10 minutes by default.
+	IdleTimeout time.Duration
+}
+
+// Option configures a rate limiter.
+type Option func(*Options)
+
+// WithName sets the name of a rate limiter, which is used as the kind
+// of the LimitExceededError it returns.
+func WithName(name string) Option {
+	return func(opts *Options) {
+		opts.Name = name
+	}
+}
+
+// WithIdleTimeout sets the time after which an unused key is forgotten
+// by a KeyedLimiter.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(opts *Options) {
+		opts.IdleTimeout = d
+	}
+}
+
+// newOptions applies options over the defaults.
+func newOptions(options []Option) *Options {
+	opts := &Options{
+		Name:        "rate",
+		IdleTimeout: 10 * time.Minute,
+	}
+	for _, o := range options {
+		o(opts)
+	}
+	return opts
+}
+
+// limitExceeded returns the error for a rejected permit.
+func limitExceeded(name string) error {
+	return orerr.New(orerr.LimitExceededError{Kind: name}, orerr.WithStatus(statuscodes.RateLimited))
+}
+
+// exceedsDeadline returns true if ctx has a deadline before at.
+func exceedsDeadline(ctx context.Context, at time.Time) bool {
+	deadline, ok := ctx.Deadline()
+	return ok && deadline.Before(at)
+}
+
+// sleep waits for d, unless ctx is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
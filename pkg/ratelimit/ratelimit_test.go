@@ -0,0 +1,117 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/grevych/gobox/pkg/orerr"
+	"github.com/grevych/gobox/pkg/ratelimit"
+	"github.com/grevych/gobox/pkg/statuscodes"
+)
+
+// assertLimited checks that err is a rate limit error of the given kind.
+func assertLimited(t *testing.T, err error, kind string) {
+	t.Helper()
+
+	var limitErr orerr.LimitExceededError
+	assert.Assert(t, errors.As(err, &limitErr), "unexpected error: %v", err)
+	assert.Equal(t, limitErr.Kind, kind)
+	assert.Equal(t, orerr.ExtractErrorStatusCode(err), statuscodes.RateLimited)
+	assert.Equal(t, orerr.ExtractErrorStatusCategory(err), statuscodes.CategoryClientError)
+}
+
+func TestTokenBucket_Allow(t *testing.T) {
+	b := ratelimit.NewTokenBucket(100, 3, ratelimit.WithName("test"))
+	for i := 0; i < 3; i++ {
+		assert.NilError(t, b.Allow())
+	}
+	assertLimited(t, b.Allow(), "test")
+
+	time.Sleep(20 * time.Millisecond)
+	assert.NilError(t, b.Allow())
+}
+
+func TestTokenBucket_Wait(t *testing.T) {
+	ctx := context.Background()
+	b := ratelimit.NewTokenBucket(100, 1)
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		assert.NilError(t, b.Wait(ctx))
+	}
+	assert.Assert(t, time.Since(start) >= 25*time.Millisecond)
+}
+
+func TestTokenBucket_WaitDeadline(t *testing.T) {
+	b := ratelimit.NewTokenBucket(1, 1)
+	assert.NilError(t, b.Allow())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	assertLimited(t, b.Wait(ctx), "rate")
+	assert.Assert(t, time.Since(start) < 10*time.Millisecond)
+}
+
+func TestTokenBucket_WaitCanceled(t *testing.T) {
+	b := ratelimit.NewTokenBucket(1, 1)
+	assert.NilError(t, b.Allow())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	assert.Assert(t, errors.Is(b.Wait(ctx), context.Canceled))
+}
+
+func TestSlidingWindow_Allow(t *testing.T) {
+	w := ratelimit.NewSlidingWindow(2, 20*time.Millisecond, ratelimit.WithName("test"))
+	assert.NilError(t, w.Allow())
+	assert.NilError(t, w.Allow())
+	assertLimited(t, w.Allow(), "test")
+
+	time.Sleep(25 * time.Millisecond)
+	assert.NilError(t, w.Allow())
+}
+
+func TestSlidingWindow_Wait(t *testing.T) {
+	ctx := context.Background()
+	w := ratelimit.NewSlidingWindow(2, 20*time.Millisecond)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		assert.NilError(t, w.Wait(ctx))
+	}
+	assert.Assert(t, time.Since(start) >= 40*time.Millisecond)
+}
+
+func TestSlidingWindow_WaitDeadline(t *testing.T) {
+	w := ratelimit.NewSlidingWindow(1, time.Second)
+	assert.NilError(t, w.Allow())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assertLimited(t, w.Wait(ctx), "rate")
+}
+
+func TestKeyedLimiter(t *testing.T) {
+	k := ratelimit.NewKeyedLimiter(func() ratelimit.Limiter {
+		return ratelimit.NewSlidingWindow(1, time.Minute, ratelimit.WithName("tenant"))
+	}, ratelimit.WithIdleTimeout(20*time.Millisecond))
+
+	assert.NilError(t, k.Allow("a"))
+	assert.NilError(t, k.Allow("b"))
+	assertLimited(t, k.Allow("a"), "tenant")
+	assert.Equal(t, k.Len(), 2)
+
+	// idle keys are forgotten
+	time.Sleep(25 * time.Millisecond)
+	assert.NilError(t, k.Allow("c"))
+	assert.Equal(t, k.Len(), 1)
+}
@@ -0,0 +1,101 @@
+// Description: Provides a sliding window rate limiter
+
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// _ ensures that SlidingWindow implements the Limiter interface.
+var _ Limiter = (*SlidingWindow)(nil)
+
+// SlidingWindow is a rate limiter that allows up to limit permits within
+// any window of time. Unlike a fixed window, it does not allow twice the
+// limit around the edge of a window.
+//
+// It keeps the time of every permit within the window, so limit should
+// stay reasonably small.
+type SlidingWindow struct {
+	name   string
+	limit  int
+	window time.Duration
+
+	mu sync.Mutex
+
+	// permits holds the times of the permits within the window, oldest
+	// first.
+	permits []time.Time
+}
+
+// NewSlidingWindow creates a sliding window limiter that allows up to
+// limit permits within any window of time.
+func NewSlidingWindow(limit int, window time.Duration, options ...Option) *SlidingWindow {
+	opts := newOptions(options)
+	return &SlidingWindow{
+		name:    opts.Name,
+		limit:   limit,
+		window:  window,
+		permits: make([]time.Time, 0, limit),
+	}
+}
+
+// Allow takes a permit if one is available right away, and returns a
+// limit exceeded error otherwise.
+func (w *SlidingWindow) Allow() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.take(time.Now()); !ok {
+		return limitExceeded(w.name)
+	}
+	return nil
+}
+
+// Wait blocks until a permit is available. It returns a limit exceeded
+// error without waiting if no permit is available before the deadline
+// of ctx, and ctx.Err() if ctx is done while waiting.
+func (w *SlidingWindow) Wait(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		w.mu.Lock()
+		now := time.Now()
+		next, ok := w.take(now)
+		w.mu.Unlock()
+
+		if ok {
+			return nil
+		}
+		if w.limit <= 0 || exceedsDeadline(ctx, next) {
+			return limitExceeded(w.name)
+		}
+		if err := sleep(ctx, next.Sub(now)); err != nil {
+			return err
+		}
+	}
+}
+
+// take takes a permit if one is available at now. Otherwise, it returns
+// when the next permit becomes available. It must be called with the
+// lock held.
+func (w *SlidingWindow) take(now time.Time) (time.Time, bool) {
+	start := now.Add(-w.window)
+	expired := 0
+	for expired < len(w.permits) && !w.permits[expired].After(start) {
+		expired++
+	}
+	w.permits = append(w.permits[:0], w.permits[expired:]...)
+
+	if len(w.permits) >= w.limit {
+		if len(w.permits) == 0 {
+			return now, false
+		}
+		return w.permits[0].Add(w.window), false
+	}
+	w.permits = append(w.permits, now)
+	return now, true
+}
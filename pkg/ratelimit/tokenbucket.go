@@ -0,0 +1,105 @@
+// Description: Provides a token bucket rate limiter
+
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// _ ensures that TokenBucket implements the Limiter interface.
+var _ Limiter = (*TokenBucket)(nil)
+
+// TokenBucket is a rate limiter that refills a bucket of up to burst
+// tokens at a constant rate. Each permit takes a token.
+//
+// Waiters are served in order: a call to Wait reserves a token and then
+// sleeps until it is refilled.
+type TokenBucket struct {
+	name  string
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates a token bucket that allows rate permits per
+// second, with bursts of up to burst permits. The bucket starts full.
+func NewTokenBucket(rate float64, burst int, options ...Option) *TokenBucket {
+	opts := newOptions(options)
+	return &TokenBucket{
+		name:   opts.Name,
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Allow takes a token if one is available right away, and returns a
+// limit exceeded error otherwise.
+func (b *TokenBucket) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	if b.tokens < 1 {
+		return limitExceeded(b.name)
+	}
+	b.tokens--
+	return nil
+}
+
+// Wait blocks until a token is available. It returns a limit exceeded
+// error without waiting if no token is available before the deadline of
+// ctx, and ctx.Err() if ctx is done while waiting.
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	now := time.Now()
+	b.refill(now)
+
+	// reserve the token, which may make the bucket go negative.
+	b.tokens--
+	var delay time.Duration
+	if b.tokens < 0 {
+		if b.rate <= 0 {
+			b.tokens++
+			b.mu.Unlock()
+			return limitExceeded(b.name)
+		}
+		delay = time.Duration(math.Ceil(-b.tokens / b.rate * float64(time.Second)))
+	}
+	if exceedsDeadline(ctx, now.Add(delay)) {
+		b.tokens++
+		b.mu.Unlock()
+		return limitExceeded(b.name)
+	}
+	b.mu.Unlock()
+
+	if err := sleep(ctx, delay); err != nil {
+		// give the reserved token back.
+		b.mu.Lock()
+		b.refill(time.Now())
+		b.tokens = math.Min(b.burst, b.tokens+1)
+		b.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// refill adds the tokens accumulated since the last refill. It must be
+// called with the lock held.
+func (b *TokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+}
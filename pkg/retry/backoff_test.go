@@ -0,0 +1,41 @@
+package retry
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	delays := func(p Policy, random float64, n int) []time.Duration {
+		b := newBackoff(p)
+		b.random = func() float64 { return random }
+
+		result := []time.Duration{}
+		for i := 0; i < n; i++ {
+			result = append(result, b.next())
+		}
+		return result
+	}
+
+	exponential := Policy{InitialDelay: time.Second, MaxDelay: 5 * time.Second, Multiplier: 2}
+	assert.DeepEqual(t, delays(exponential, 0.5, 4), []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second,
+	})
+
+	exponential.Jitter = 0.5
+	assert.DeepEqual(t, delays(exponential, 0, 2), []time.Duration{
+		500 * time.Millisecond, time.Second,
+	})
+
+	constant := Policy{Strategy: Constant, InitialDelay: time.Second, Multiplier: 2}
+	assert.DeepEqual(t, delays(constant, 0.5, 3), []time.Duration{
+		time.Second, time.Second, time.Second,
+	})
+
+	decorrelated := Policy{Strategy: DecorrelatedJitter, InitialDelay: time.Second, MaxDelay: 20 * time.Second}
+	assert.DeepEqual(t, delays(decorrelated, 1, 4), []time.Duration{
+		time.Second, 3 * time.Second, 9 * time.Second, 20 * time.Second,
+	})
+}
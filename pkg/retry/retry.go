@@ -0,0 +1,242 @@
+// Description: Provides a retry executor for errors marked with orerr.Retryable
+
+// Package retry retries functions that fail with errors marked as
+// retryable with orerr.Retryable.
+//
+//	err := retry.Do(ctx, "billing.charge", func(ctx context.Context) error {
+//	    err := billing.Charge(ctx, invoice)
+//	    if isTransient(err) {
+//	        return orerr.Retryable(err)
+//	    }
+//	    return err
+//	}, retry.DefaultPolicy)
+//
+// Every attempt runs as its own trace.StartCall, so attempts show up as
+// child calls in traces, logs and metrics.
+package retry
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/grevych/gobox/pkg/log"
+	"github.com/grevych/gobox/pkg/orerr"
+	"github.com/grevych/gobox/pkg/trace"
+)
+
+// AttemptsMetaKey is the orerr.Meta key holding the number of attempts
+// made by Do when it returns an error.
+const AttemptsMetaKey = "retry-attempts"
+
+// Strategy is the backoff strategy between attempts.
+type Strategy int
+
+const (
+	// Exponential multiplies the delay by Multiplier after every
+	// attempt, with up to Jitter of randomization.
+	Exponential Strategy = iota
+
+	// DecorrelatedJitter picks a random delay between InitialDelay and
+	// three times the previous delay, which spreads out the retries of
+	// concurrent callers better than Exponential.
+	DecorrelatedJitter
+
+	// Constant always waits InitialDelay.
+	Constant
+)
+
+// String returns the name of the strategy.
+func (s Strategy) String() string {
+	switch s {
+	case Exponential:
+		return "exponential"
+	case DecorrelatedJitter:
+		return "decorrelated_jitter"
+	case Constant:
+		return "constant"
+	default:
+		return fmt.Sprintf("Strategy(%d)", int(s))
+	}
+}
+
+// DefaultPolicy is a reasonable policy for calls to other services: at
+// most three attempts with an exponential backoff starting at 100ms and
+// capped at 10 seconds.
+//
+//nolint:gochecknoglobals // Why: shared defaults
+var DefaultPolicy = Policy{
+	Strategy:     Exponential,
+	MaxAttempts:  3,
+	InitialDelay: 100 * time.Millisecond,
+	MaxDelay:     10 * time.Second,
+	Multiplier:   2,
+	Jitter:       0.2,
+}
+
+// Policy controls how Do retries a function.
+type Policy struct {
+	// Strategy is the backoff strategy between attempts.
+	Strategy Strategy
+
+	// MaxAttempts is the maximum number of attempts, including the
+	// first one. Zero means no limit other than the context.
+	MaxAttempts int
+
+	// InitialDelay is the delay before the first retry.
+	InitialDelay time.Duration
+
+	// MaxDelay caps the delay between attempts. Zero means no cap.
+	MaxDelay time.Duration
+
+	// Multiplier grows the delay after each attempt with the Exponential
+	// strategy. Values below 1 are treated as 1.
+	Multiplier float64
+
+	// Jitter randomizes each delay of the Exponential strategy by up to
+	// the given fraction of it in either direction. It is clamped to
+	// [0, 1].
+	Jitter float64
+}
+
+// Backoff returns a function computing the delays between attempts of
+// the policy, one delay per call. It is meant for callers scheduling
+// their own attempts, like job runners.
+func (p Policy) Backoff() func() time.Duration {
+	return newBackoff(p).next
+}
+
+// Do calls fn until it succeeds, fails with an error that is not
+// retryable (see orerr.IsRetryable), or the policy gives up.
+//
+// Do gives up when the delay before the next attempt would end after
+// the deadline of ctx, and stops waiting as soon as ctx is done. In both
+// cases, the error of the last attempt is returned. Do does not know how
+// long an attempt takes: an attempt started before the deadline may
+// still run out of time.
+//
+// The returned error carries the number of attempts made, as the
+// AttemptsMetaKey key of orerr.Meta.
+func Do(ctx context.Context, name string, fn func(ctx context.Context) error, policy Policy) error {
+	b := newBackoff(policy)
+
+	for attempt := 1; ; attempt++ {
+		err := call(ctx, name, attempt, fn)
+		if err == nil {
+			return nil
+		}
+		if !orerr.IsRetryable(err) || (policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts) {
+			return withAttempts(err, attempt)
+		}
+
+		delay := b.next()
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return withAttempts(err, attempt)
+		}
+
+		log.Debug(ctx, "retrying", log.F{
+			"retry.name":     name,
+			"retry.attempt":  attempt,
+			"retry.strategy": policy.Strategy.String(),
+			"retry.delay":    delay.String(),
+		})
+		if !sleep(ctx, delay) {
+			return withAttempts(err, attempt)
+		}
+	}
+}
+
+// call runs a single attempt as its own call.
+func call(ctx context.Context, name string, attempt int, fn func(ctx context.Context) error) error {
+	ctx = trace.StartCall(ctx, name, log.F{"retry.attempt": attempt})
+	defer trace.EndCall(ctx)
+
+	return trace.SetCallStatus(ctx, fn(ctx))
+}
+
+// withAttempts adds the number of attempts to the metadata of err.
+func withAttempts(err error, attempts int) error {
+	meta := map[string]string{}
+	for k, v := range orerr.ExtractErrorMetadata(err) {
+		meta[k] = v
+	}
+	meta[AttemptsMetaKey] = strconv.Itoa(attempts)
+	return orerr.Meta(err, meta)
+}
+
+// Attempts returns the number of attempts recorded on an error returned
+// by Do, or 0 if there is none.
+func Attempts(err error) int {
+	n, err := strconv.Atoi(orerr.ExtractErrorMetadata(err)[AttemptsMetaKey])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// sleep waits for d. It returns false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// backoff computes the delays between attempts.
+type backoff struct {
+	policy Policy
+
+	// attempt is the number of delays computed so far.
+	attempt int
+
+	// prev is the previous delay, used by DecorrelatedJitter.
+	prev time.Duration
+
+	// random returns a number in [0, 1), it is replaced in tests.
+	random func() float64
+}
+
+// newBackoff creates a backoff for the given policy.
+func newBackoff(p Policy) *backoff {
+	return &backoff{policy: p, random: rand.Float64} //nolint:gosec // Why: jitter does not need crypto rand
+}
+
+// next returns the delay before the next attempt.
+func (b *backoff) next() time.Duration {
+	p := b.policy
+
+	// leave room for the jitter so the result never overflows
+	limit := float64(math.MaxInt64 / 4)
+	if p.MaxDelay > 0 {
+		limit = float64(p.MaxDelay)
+	}
+
+	var delay float64
+	switch p.Strategy {
+	case Constant:
+		delay = float64(p.InitialDelay)
+	case DecorrelatedJitter:
+		base := float64(p.InitialDelay)
+		high := math.Max(base, float64(b.prev)*3)
+		delay = base + (high-base)*b.random()
+	case Exponential:
+		fallthrough
+	default:
+		multiplier := math.Max(p.Multiplier, 1)
+		delay = math.Min(float64(p.InitialDelay)*math.Pow(multiplier, float64(b.attempt)), limit)
+		jitter := math.Min(math.Max(p.Jitter, 0), 1)
+		delay += delay * jitter * (2*b.random() - 1)
+	}
+
+	b.attempt++
+	b.prev = time.Duration(math.Min(delay, limit))
+	return b.prev
+}
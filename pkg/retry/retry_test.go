@@ -0,0 +1,84 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/grevych/gobox/pkg/orerr"
+	"github.com/grevych/gobox/pkg/retry"
+)
+
+var fast = retry.Policy{MaxAttempts: 5, InitialDelay: time.Millisecond, Multiplier: 2}
+
+// failing returns a function that fails with err the first n calls and
+// counts its calls.
+func failing(n int, err error, calls *int) func(context.Context) error {
+	return func(context.Context) error {
+		*calls++
+		if *calls <= n {
+			return err
+		}
+		return nil
+	}
+}
+
+func TestDo_RetriesRetryableErrors(t *testing.T) {
+	calls := 0
+	err := retry.Do(context.Background(), "test", failing(2, orerr.Retryable(errors.New("flaky")), &calls), fast)
+	assert.NilError(t, err)
+	assert.Equal(t, calls, 3)
+}
+
+func TestDo_DoesNotRetryOtherErrors(t *testing.T) {
+	calls := 0
+	err := retry.Do(context.Background(), "test", failing(2, errors.New("broken"), &calls), fast)
+	assert.Error(t, err, "broken")
+	assert.Equal(t, calls, 1)
+	assert.Equal(t, retry.Attempts(err), 1)
+}
+
+func TestDo_GivesUp(t *testing.T) {
+	calls := 0
+	flaky := orerr.Meta(orerr.Retryable(errors.New("flaky")), map[string]string{"key": "value"})
+	err := retry.Do(context.Background(), "test", failing(10, flaky, &calls), fast)
+	assert.ErrorContains(t, err, "flaky")
+	assert.Equal(t, calls, 5)
+	assert.Equal(t, retry.Attempts(err), 5)
+
+	// existing metadata is kept
+	assert.DeepEqual(t, orerr.ExtractErrorMetadata(err), map[string]string{"key": "value", retry.AttemptsMetaKey: "5"})
+}
+
+func TestDo_RespectsDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	calls := 0
+	policy := retry.Policy{Strategy: retry.Constant, InitialDelay: 20 * time.Millisecond}
+	start := time.Now()
+	err := retry.Do(ctx, "test", failing(100, orerr.Retryable(errors.New("flaky")), &calls), policy)
+	assert.ErrorContains(t, err, "flaky")
+
+	// the attempt that could not finish in time is not started
+	assert.Assert(t, time.Since(start) < 50*time.Millisecond)
+	assert.Equal(t, calls, 3)
+	assert.Equal(t, retry.Attempts(err), 3)
+}
+
+func TestDo_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	calls := 0
+	policy := retry.Policy{Strategy: retry.DecorrelatedJitter, InitialDelay: time.Hour}
+	err := retry.Do(ctx, "test", failing(100, orerr.Retryable(errors.New("flaky")), &calls), policy)
+	assert.ErrorContains(t, err, "flaky")
+	assert.Equal(t, calls, 1)
+}
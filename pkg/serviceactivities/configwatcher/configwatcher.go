@@ -0,0 +1,67 @@
+// Description: Provides a service activity watching a config file
+
+// Package configwatcher provides a service activity reloading a config
+// when its config file changes.
+package configwatcher
+
+import (
+	"context"
+	"sync"
+
+	"github.com/grevych/gobox/pkg/async"
+	"github.com/grevych/gobox/pkg/cfg"
+)
+
+// ServiceActivity implements the async.Runner & async.Closer interface for
+// watching a config file with a cfg.Watcher.
+type ServiceActivity[T any] struct {
+	watcher   *cfg.Watcher[T]
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Make sure ServiceActivity implements async.Runner interface.
+var _ async.Runner = (*ServiceActivity[struct{}])(nil)
+
+// Make sure ServiceActivity implemets async.Closer interface.
+var _ async.Closer = (*ServiceActivity[struct{}])(nil)
+
+// New creates a new service activity that watches the config file of
+// the provided watcher. The config should be loaded with Load first,
+// and the subscribers registered with Subscribe.
+func New[T any](w *cfg.Watcher[T]) *ServiceActivity[T] {
+	return &ServiceActivity[T]{
+		watcher: w,
+		done:    make(chan struct{}),
+	}
+}
+
+// Run runs the config watcher service activity
+func (sa *ServiceActivity[T]) Run(ctx context.Context) error {
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-sa.done:
+			cancel()
+		case <-watchCtx.Done():
+		}
+	}()
+
+	err := sa.watcher.Run(watchCtx)
+	select {
+	case <-sa.done:
+		return nil
+	default:
+		return err
+	}
+}
+
+// Close closes the config watcher service activity. It is safe to call
+// Close more than once.
+func (sa *ServiceActivity[T]) Close(_ context.Context) error {
+	sa.closeOnce.Do(func() {
+		close(sa.done)
+	})
+	return nil
+}
@@ -0,0 +1,48 @@
+package configwatcher
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/grevych/gobox/pkg/cfg"
+)
+
+type config struct {
+	Name string `yaml:"Name"`
+}
+
+func TestServiceActivity_RunAndClose(t *testing.T) {
+	var lock sync.Mutex
+	content := "Name: old"
+	reader := func(string) ([]byte, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		return []byte(content), nil
+	}
+
+	w := cfg.NewWatcher[config]("app.yaml", cfg.WithWatchReader(reader), cfg.WithWatchInterval(5*time.Millisecond))
+	assert.NilError(t, w.Load())
+	changes := make(chan string, 1)
+	w.Subscribe(func(old, new config) {
+		changes <- old.Name + "->" + new.Name
+	})
+
+	svc := New(w)
+	errs := make(chan error)
+	go func() { errs <- svc.Run(context.Background()) }()
+
+	lock.Lock()
+	content = "Name: new"
+	lock.Unlock()
+	assert.Equal(t, <-changes, "old->new")
+
+	assert.NilError(t, svc.Close(context.Background()))
+	assert.NilError(t, <-errs)
+
+	// closing again is a no-op
+	assert.NilError(t, svc.Close(context.Background()))
+}
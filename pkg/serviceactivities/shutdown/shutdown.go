@@ -79,11 +79,14 @@ func (s *ServiceActivity) Close(_ context.Context) error {
 
 // HandleShutdownConditions encapsulates the shutdown logging logic for services
 // into a simple function, and returns a boolean indicating if it is a graceful
-// shutdown or not
+// shutdown or not.
+//
+// err may be the aggregated error returned by async.TaskGroup.WaitContext, in
+// which case the shutdown is only graceful if every joined error was caused
+// by a SIGTERM.
 func HandleShutdownConditions(ctx context.Context, err error) bool {
 	if err != nil {
-		var fsErr SignalError
-		if is := errors.As(err, &fsErr); is && (fsErr.Signal == syscall.SIGTERM) {
+		if isTermination(err) {
 			log.Info(ctx, "service gracefully shutdown due to termination", events.NewErrorInfo(err))
 			return true
 		}
@@ -96,3 +99,20 @@ func HandleShutdownConditions(ctx context.Context, err error) bool {
 	log.Info(ctx, "service gracefully shutdown without error")
 	return true
 }
+
+// isTermination returns true if err was caused by a SIGTERM. Errors joined
+// with errors.Join must all have been caused by a SIGTERM.
+func isTermination(err error) bool {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs := joined.Unwrap()
+		for _, err := range errs {
+			if !isTermination(err) {
+				return false
+			}
+		}
+		return len(errs) > 0
+	}
+
+	var fsErr SignalError
+	return errors.As(err, &fsErr) && fsErr.Signal == syscall.SIGTERM
+}
@@ -3,12 +3,15 @@ package shutdown
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sync"
 	"syscall"
 	"testing"
 	"time"
 
 	"gotest.tools/v3/assert"
+
+	"github.com/grevych/gobox/pkg/orerr"
 )
 
 func TestServiceActivity_Runt(t *testing.T) {
@@ -73,3 +76,18 @@ func TestServiceActivity_Close(t *testing.T) {
 
 	assert.Assert(t, shutdownErr == nil)
 }
+
+func TestHandleShutdownConditions(t *testing.T) {
+	ctx := context.Background()
+	term := orerr.ShutdownError{Err: NewSignalError(syscall.SIGTERM)}
+	hup := orerr.ShutdownError{Err: NewSignalError(syscall.SIGHUP)}
+
+	assert.Assert(t, HandleShutdownConditions(ctx, nil))
+	assert.Assert(t, HandleShutdownConditions(ctx, term))
+	assert.Assert(t, !HandleShutdownConditions(ctx, hup))
+	assert.Assert(t, !HandleShutdownConditions(ctx, errors.New("boom")))
+
+	// errors aggregated by async.TaskGroup.WaitContext
+	assert.Assert(t, HandleShutdownConditions(ctx, errors.Join(term, fmt.Errorf("wrapped: %w", term))))
+	assert.Assert(t, !HandleShutdownConditions(ctx, errors.Join(term, errors.New("boom"))))
+}